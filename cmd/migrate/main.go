@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/migrations"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up          apply every pending migration
+  down N      roll back the N most recent migrations
+  status      list migrations and whether they are applied
+  force V     record the schema as being at version V without running SQL
+
+Flags:
+`
+
+func main() {
+
+	driver := flag.String("driver", "", "Database driver (mysql or sqlite), inferred from the DSN scheme when empty")
+	dsn := flag.String("dsn", "web:snippetbox_dev@/snippetbox?parseTime=true", "Data source name, e.g. a MySQL DSN or sqlite://snippetbox.db")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime)
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbDriver, dbDSN, err := database.ParseDSN(*driver, *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, err := database.OpenDB(dbDriver, dbDSN)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	defer db.Close()
+
+	migrator, err := migrations.New(db, dbDriver)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Printf("Applied %d migrations", count)
+
+	case "down":
+		n, err := intArg(1)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		count, err := migrator.Down(n)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Printf("Rolled back %d migrations", count)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+		for _, status := range statuses {
+			state := "pending"
+			if status.Dirty {
+				state = "dirty"
+			} else if status.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, state)
+		}
+		w.Flush()
+
+	case "force":
+		version, err := intArg(1)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		if err := migrator.Force(version); err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Printf("Forced schema to version %d", version)
+
+	default:
+		errorLog.Printf("unknown command %q", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func intArg(i int) (int, error) {
+	if flag.NArg() <= i {
+		return 0, fmt.Errorf("%s needs a numeric argument", flag.Arg(0))
+	}
+
+	n, err := strconv.Atoi(flag.Arg(i))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s needs a non-negative number, got %q", flag.Arg(0), flag.Arg(i))
+	}
+
+	return n, nil
+}
@@ -1,48 +1,375 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/andremfp/snippetbox/internal/certs"
 	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/health"
+	"github.com/andremfp/snippetbox/internal/logging"
+	"github.com/andremfp/snippetbox/internal/metrics"
+	"github.com/andremfp/snippetbox/internal/middleware"
+	"github.com/andremfp/snippetbox/internal/migrations"
+	"github.com/andremfp/snippetbox/internal/ratelimit"
 	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/session"
+	"github.com/andremfp/snippetbox/internal/sweeper"
 	"github.com/andremfp/snippetbox/internal/templates"
 	"github.com/go-playground/form/v4"
 )
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("exiting", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
 
+// run serves until the process is told to stop. It returns rather than exits
+// on failure so its deferred cleanup always runs, in reverse order of setup:
+// background workers first and the database last. Its logger becomes the
+// default, which main reports any error to.
+func run() error {
 	addr := flag.String("addr", ":4000", "HTTP network address")
-	dsn := flag.String("dsn", "web:snippetbox_dev@/snippetbox?parseTime=true", "MySQL data source name")
+	driver := flag.String("driver", "", "Database driver (mysql, sqlite or memory), inferred from the DSN scheme when empty")
+	dsn := flag.String("dsn", "web:snippetbox_dev@/snippetbox?parseTime=true", "Data source name, e.g. a MySQL DSN, sqlite://snippetbox.db or memory://")
+	queryTimeout := flag.Duration("query-timeout", 3*time.Second, "Maximum time a single database query may take")
+	migrate := flag.Bool("migrate", false, "Apply pending schema migrations before serving")
+	sweepInterval := flag.Duration("sweep-interval", 10*time.Minute, "How often expired snippets are purged, 0 to disable")
+	sweepBatch := flag.Int("sweep-batch", 500, "Maximum number of expired snippets deleted per query")
+	sessionLifetime := flag.Duration("session-lifetime", 12*time.Hour, "Maximum lifetime of a session")
+	sessionIdleTimeout := flag.Duration("session-idle-timeout", 0, "End sessions unused for this long, 0 to disable")
+	secureCookies := flag.Bool("secure-cookies", true, "Only send the session cookie over HTTPS, turn off for plain HTTP development on hosts other than localhost")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long in-flight requests may take to finish on SIGINT or SIGTERM")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file, with -tls-key serves HTTPS")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a generated certificate for localhost, for development")
+	tlsReloadInterval := flag.Duration("tls-reload-interval", 10*time.Second, "How often -tls-cert and -tls-key are checked for changes, 0 to only reload on SIGHUP")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "Maximum time to read a request's headers, 0 for no limit")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "Maximum time to read a whole request, body included, 0 for no limit")
+	writeTimeout := flag.Duration("write-timeout", 15*time.Second, "Maximum time from the end of the request headers to the end of the response, 0 for no limit")
+	idleTimeout := flag.Duration("idle-timeout", time.Minute, "How long an idle keep-alive connection is kept open, 0 to use -read-timeout")
+	maxHeaderBytes := flag.Int("max-header-bytes", 64<<10, "Maximum size of a request's headers")
+	redirectAddr := flag.String("http-redirect-addr", "", "HTTP network address that redirects to HTTPS, empty to disable")
+	adminAddr := flag.String("admin-addr", "localhost:4001", "HTTP network address serving /metrics, /healthz and /readyz, empty to disable; keep it private")
+	readyTimeout := flag.Duration("ready-timeout", 2*time.Second, "How long the /readyz checks may take before the instance is reported not ready")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format, text or json")
+	rateLimitAuth := ratelimit.Budget{Limit: 10, Period: time.Minute}
+	flag.TextVar(&rateLimitAuth, "rate-limit-auth", rateLimitAuth, "Signup, login and failed API authentication attempts allowed per client IP, like 10/1m, or off")
+	rateLimitSnippets := ratelimit.Budget{Limit: 30, Period: time.Hour}
+	flag.TextVar(&rateLimitSnippets, "rate-limit-snippets", rateLimitSnippets, "Snippets a user may create or edit, like 30/1h, or off")
+	rateLimitAPI := ratelimit.Budget{Limit: 300, Period: time.Minute}
+	flag.TextVar(&rateLimitAPI, "rate-limit-api", rateLimitAPI, "API requests allowed per token, like 300/1m, or off")
+	var logLevel slog.Level
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "Minimum level logged: debug, info, warn or error")
 	flag.Parse()
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	logger, err := logging.New(os.Stdout, *logFormat, logLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	switch {
+	case (*tlsCert == "") != (*tlsKey == ""):
+		return errors.New("-tls-cert and -tls-key must be given together")
+	case *tlsSelfSigned && *tlsCert != "":
+		return errors.New("-tls-self-signed cannot be combined with -tls-cert")
+	case *redirectAddr != "" && *tlsCert == "" && !*tlsSelfSigned:
+		return errors.New("-http-redirect-addr needs -tls-cert or -tls-self-signed")
+	}
+
+	dbDriver, dbDSN, err := database.ParseDSN(*driver, *dsn)
+	if err != nil {
+		return err
+	}
+
+	var db *sql.DB
+	var migrator *migrations.Migrator
+	if dbDriver != database.DriverMemory {
+		db, err = database.OpenDB(dbDriver, dbDSN)
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+
+		migrator, err = migrations.New(db, dbDriver)
+		if err != nil {
+			return err
+		}
 
-	db, err := database.OpenDB(*dsn)
+		if *migrate {
+			count, err := migrator.Up()
+			if err != nil {
+				return err
+			}
+			logger.Info("applied migrations", slog.Int("count", count))
+		}
+
+		if err := migrator.CheckCurrent(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	snippetStore, err := database.NewStore(dbDriver, db, *queryTimeout)
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
 	}
 
-	defer db.Close()
+	userStore, err := database.NewUserStore(dbDriver, db, *queryTimeout)
+	if err != nil {
+		return err
+	}
+
+	tokenStore, err := database.NewTokenStore(dbDriver, db, *queryTimeout)
+	if err != nil {
+		return err
+	}
+
+	registry := metrics.NewRegistry(logger)
+	appMetrics := server.NewMetrics(registry)
+
+	snippetStore = database.InstrumentStore(snippetStore, appMetrics.ObserveStore)
+	userStore = database.InstrumentUserStore(userStore, appMetrics.ObserveStore)
+	tokenStore = database.InstrumentTokenStore(tokenStore, appMetrics.ObserveStore)
+
+	if db != nil {
+		metrics.RegisterDBStats(registry, "snippetbox_db", db)
+	}
+
+	registry.GaugeFunc("snippetbox_snippets", "Live snippets, not counting expired ones awaiting the sweeper.", func(ctx context.Context) (float64, error) {
+		count, err := snippetStore.Count(ctx)
+		return float64(count), err
+	})
+
+	if *sweepInterval > 0 {
+		if *sweepBatch < 1 {
+			return sweeper.ErrBatchSize
+		}
+
+		expirySweeper := &sweeper.Sweeper{
+			Store:     snippetStore,
+			Interval:  *sweepInterval,
+			BatchSize: *sweepBatch,
+			Logger:    logger,
+		}
+
+		expirySweeper.Start()
+		defer expirySweeper.Stop()
+	}
+
+	// Sessions go in the database when there is one, so logins survive a
+	// restart.
+	var sessionStore session.Store
+	if db != nil {
+		sqlStore := session.NewSQLStore(db, 5*time.Minute)
+		defer sqlStore.StopCleanup()
+		sessionStore = sqlStore
+	} else {
+		memoryStore := session.NewMemoryStore(5 * time.Minute)
+		defer memoryStore.StopCleanup()
+		sessionStore = memoryStore
+	}
+
+	sessions := session.New(sessionStore)
+	sessions.Lifetime = *sessionLifetime
+	sessions.IdleTimeout = *sessionIdleTimeout
+	sessions.Cookie.Secure = *secureCookies
+	sessions.ErrorFunc = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Error("session",
+			slog.String("request_id", middleware.RequestID(r)),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Any("error", err))
+		middleware.Error(w, r, http.StatusInternalServerError)
+	}
 
 	templateCache, err := templates.NewTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
 	}
 
+	// Readiness needs the database reachable and its schema current, which
+	// could change while running, and the templates, which could not but are
+	// cheap to report on.
+	checker := &health.Checker{Timeout: *readyTimeout}
+	checker.Checks = append(checker.Checks, health.Check{Name: "templates", Run: func(context.Context) error {
+		if len(templateCache) == 0 {
+			return errors.New("no templates loaded")
+		}
+		return nil
+	}})
+
+	if db != nil {
+		checker.Checks = append(checker.Checks,
+			health.Check{Name: "database", Run: db.PingContext},
+			health.Check{Name: "migrations", Run: migrator.CheckCurrent},
+		)
+	}
+
+	// Buckets are kept per instance, so with several instances behind a
+	// load balancer each budget applies to each instance.
+	rateLimitStore := ratelimit.NewMemoryStore(time.Minute)
+	defer rateLimitStore.StopCleanup()
+
 	app := &server.Application{
-		InfoLog:       infoLog,
-		ErrorLog:      errorLog,
-		SnippetStore:  &database.SnippetModel{DB: db},
+		Logger:        logger,
+		SnippetStore:  snippetStore,
+		UserStore:     userStore,
+		TokenStore:    tokenStore,
+		Sessions:      sessions,
 		TemplateCache: templateCache,
 		FormDecoder:   form.NewDecoder(),
+		Metrics:       appMetrics,
+		RateLimits: server.RateLimits{
+			Store:    rateLimitStore,
+			Auth:     rateLimitAuth,
+			Snippets: rateLimitSnippets,
+			API:      rateLimitAPI,
+		},
+	}
+
+	limits := server.Limits{
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
+
+	webserver := server.NewWebserver(*addr, logger, app, limits)
+
+	// The first SIGINT or SIGTERM starts a graceful shutdown, failing
+	// readiness straight away. Signals are then no longer caught, so a second
+	// one kills the process without waiting for the drain.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-quit
+		signal.Stop(quit)
+		logger.Info("shutting down", slog.String("signal", sig.String()), slog.Duration("drain_timeout", *shutdownTimeout))
+		checker.ShutDown()
+		cancel()
+	}()
+
+	if *tlsSelfSigned {
+		certPEM, keyPEM, err := certs.SelfSigned(30*24*time.Hour, "localhost", "127.0.0.1", "::1")
+		if err != nil {
+			return err
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return err
+		}
+
+		webserver.TLSConfig = certs.TLSConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		})
+		logger.Warn("using a self-signed certificate for localhost, browsers will warn about it")
+	}
+
+	if *tlsCert != "" {
+		reloader := &certs.Reloader{
+			CertFile: *tlsCert,
+			KeyFile:  *tlsKey,
+			Interval: *tlsReloadInterval,
+			Logger:   logger,
+		}
+
+		if err := reloader.Reload(); err != nil {
+			return err
+		}
+
+		if *tlsReloadInterval > 0 {
+			reloader.Start()
+			defer reloader.Stop()
+		}
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		go func() {
+			for range hup {
+				if err := reloader.Reload(); err != nil {
+					logger.Error("reloading TLS certificate", slog.String("file", *tlsCert), slog.Any("error", err))
+					continue
+				}
+				logger.Info("reloaded TLS certificate", slog.String("file", *tlsCert))
+			}
+		}()
+
+		webserver.TLSConfig = certs.TLSConfig(reloader.GetCertificate)
+	}
+
+	servers := []*http.Server{webserver}
+	if *redirectAddr != "" {
+		servers = append(servers, server.NewRedirectServer(*redirectAddr, *addr, logger, limits))
+	}
+	if *adminAddr != "" {
+		servers = append(servers, server.NewAdminServer(*adminAddr, logger, registry, checker, limits))
+	}
+
+	listeners := make([]net.Listener, len(servers))
+	for i, srv := range servers {
+		listeners[i], err = net.Listen("tcp", srv.Addr)
+		if err != nil {
+			// Nothing serves the listeners yet, so nothing else closes them.
+			for _, l := range listeners[:i] {
+				l.Close()
+			}
+			return err
+		}
+	}
+
+	logger.Info("starting server", slog.String("addr", *addr), slog.Bool("tls", webserver.TLSConfig != nil))
+
+	if *redirectAddr != "" {
+		logger.Info("redirecting HTTP to HTTPS", slog.String("addr", *redirectAddr))
+	}
+
+	if *adminAddr != "" {
+		logger.Info("serving metrics and health probes", slog.String("addr", *adminAddr))
+	}
+
+	// Whichever server stops first, by a signal or a failure, takes the
+	// others down with it.
+	serveErrs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func() {
+			err := server.Serve(ctx, srv, listeners[i], *shutdownTimeout)
+			cancel()
+			serveErrs <- err
+		}()
+	}
+
+	var errs []error
+	for range servers {
+		errs = append(errs, <-serveErrs)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("server: %w", err)
 	}
 
-	webserver := server.NewWebserver(*addr, errorLog, app)
+	logger.Info("server stopped, all connections drained")
 
-	infoLog.Printf("Starting server on %s", *addr)
-	err = webserver.ListenAndServe()
-	errorLog.Fatal(err)
+	return nil
 }
@@ -6,10 +6,27 @@ require github.com/approvals/go-approval-tests v0.0.0-20220530063708-32d5677069b
 
 require github.com/go-sql-driver/mysql v1.7.1
 
-require gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0
+require (
+	github.com/go-playground/form/v4 v4.2.1
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/justinas/alice v1.2.0
+	golang.org/x/crypto v0.31.0
+	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0
+	modernc.org/sqlite v1.33.1
+)
 
 require (
-	github.com/go-playground/form/v4 v4.2.1 // indirect
-	github.com/julienschmidt/httprouter v1.3.0 // indirect
-	github.com/justinas/alice v1.2.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
 )
@@ -0,0 +1,217 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNotLoaded = errors.New("certs: no certificate loaded")
+
+// TLSConfig returns the server's TLS settings: TLS 1.2 or later, and for
+// TLS 1.2 only forward-secret AEAD cipher suites. TLS 1.3 suites are not
+// configurable and are all fine. Key exchanges are left to Go's defaults,
+// which add post-quantum ones as they become available.
+func TLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: getCertificate,
+	}
+}
+
+// Reloader serves the certificate in CertFile and KeyFile, reloading it when
+// Reload is called or, once started, when either file changes. A pair that
+// fails to load leaves the previous certificate in use.
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	// Interval is how often the files are checked for changes.
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// Reload loads the certificate from disk.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate is for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cert == nil {
+		return nil, ErrNotLoaded
+	}
+
+	return r.cert, nil
+}
+
+// Start checks the files every Interval in the background until Stop is
+// called.
+func (r *Reloader) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stop = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.reloadIfChanged()
+			}
+		}
+	}()
+}
+
+// Stop waits for the watcher to exit.
+func (r *Reloader) Stop() {
+	if r.stop == nil {
+		return
+	}
+
+	r.stop()
+	<-r.done
+}
+
+func (r *Reloader) reloadIfChanged() {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		r.Logger.Error("checking TLS certificate", slog.String("file", r.CertFile), slog.Any("error", err))
+		return
+	}
+
+	r.mu.RLock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+
+	if !changed {
+		return
+	}
+
+	// A failed load keeps the old modification time, so a pair caught
+	// half-written is retried on the next tick.
+	if err := r.Reload(); err != nil {
+		r.Logger.Error("reloading TLS certificate", slog.String("file", r.CertFile), slog.Any("error", err))
+		return
+	}
+
+	r.Logger.Info("reloaded TLS certificate", slog.String("file", r.CertFile))
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, name := range []string{r.CertFile, r.KeyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// SelfSigned returns a PEM-encoded certificate and key for hosts, which may
+// be names or IP addresses, valid for validFor. It is for local development:
+// browsers will warn about it.
+func SelfSigned(validFor time.Duration, hosts ...string) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Snippetbox development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certBuf, keyBuf bytes.Buffer
+	pem.Encode(&certBuf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(&keyBuf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certBuf.Bytes(), keyBuf.Bytes(), nil
+}
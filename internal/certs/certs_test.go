@@ -0,0 +1,136 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/certs"
+)
+
+func TestSelfSigned(t *testing.T) {
+	certPEM, keyPEM, err := certs.SelfSigned(time.Hour, "localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("could not generate certificate, %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not parse certificate, %v", err)
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			t.Fatalf("could not parse leaf, %v", err)
+		}
+	}
+
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("got error %v for %s, want the certificate to cover it", err, host)
+		}
+	}
+
+	if leaf.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Errorf("got expiry %v, want within an hour", leaf.NotAfter)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+
+	r := &certs.Reloader{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		Interval: 10 * time.Millisecond,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	if _, err := r.GetCertificate(nil); !errors.Is(err, certs.ErrNotLoaded) {
+		t.Errorf("got error %v before loading, want %v", err, certs.ErrNotLoaded)
+	}
+
+	first := writeCertificate(t, r, time.Now())
+	if err := r.Reload(); err != nil {
+		t.Fatalf("could not load certificate, %v", err)
+	}
+	assertCertificate(t, r, first)
+
+	r.Start()
+	defer r.Stop()
+
+	t.Run("a broken pair keeps the current certificate", func(t *testing.T) {
+		if err := os.WriteFile(r.KeyFile, []byte("garbage"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Reload(); err == nil {
+			t.Error("got no error loading a broken key, want one")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		assertCertificate(t, r, first)
+	})
+
+	t.Run("changed files are picked up", func(t *testing.T) {
+		second := writeCertificate(t, r, time.Now().Add(time.Minute))
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			cert, _ := r.GetCertificate(nil)
+			if string(cert.Certificate[0]) == string(second) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Error("got the old certificate, want the rewritten one")
+	})
+}
+
+// writeCertificate writes a new pair to r's files with the given modification
+// time and returns the certificate's DER bytes.
+func writeCertificate(t *testing.T, r *certs.Reloader, modTime time.Time) []byte {
+	t.Helper()
+
+	certPEM, keyPEM, err := certs.SelfSigned(time.Hour, "localhost")
+	if err != nil {
+		t.Fatalf("could not generate certificate, %v", err)
+	}
+
+	for name, data := range map[string][]byte{r.CertFile: certPEM, r.KeyFile: keyPEM} {
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert.Certificate[0]
+}
+
+func assertCertificate(t *testing.T, r *certs.Reloader, want []byte) {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("could not get certificate, %v", err)
+	}
+
+	if string(cert.Certificate[0]) != string(want) {
+		t.Error("got a different certificate than expected")
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+// ParseDSN works out which driver a data source name belongs to. An explicit
+// driver wins, otherwise a "mysql://", "sqlite://" or "memory://" prefix
+// selects it and anything else is treated as a MySQL DSN. The scheme is stripped from the
+// returned DSN so it can be handed straight to sql.Open.
+func ParseDSN(driver, dsn string) (string, string, error) {
+	if scheme, rest, found := strings.Cut(dsn, "://"); found {
+		switch scheme {
+		case DriverMySQL, DriverSQLite, DriverMemory:
+			if driver != "" && driver != scheme {
+				return "", "", fmt.Errorf("database: driver %q does not match DSN scheme %q", driver, scheme)
+			}
+			return scheme, rest, nil
+		}
+	}
+
+	if driver == "" {
+		driver = DriverMySQL
+	}
+
+	switch driver {
+	case DriverMySQL, DriverSQLite, DriverMemory:
+		return driver, dsn, nil
+	}
+
+	return "", "", fmt.Errorf("database: unsupported driver %q", driver)
+}
+
+func OpenDB(driver, dsn string) (*sql.DB, error) {
+	if driver == DriverMemory {
+		return nil, fmt.Errorf("database: the %s driver has no SQL database to open", driver)
+	}
+
+	if driver == DriverSQLite {
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer, and every connection to ":memory:"
+	// gets its own empty database, so share one connection.
+	if driver == DriverSQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewStore returns the Store implementation that speaks the SQL dialect of
+// the given driver, with every query bounded by queryTimeout. The memory
+// driver needs no database and ignores both.
+func NewStore(driver string, db *sql.DB, queryTimeout time.Duration) (Store, error) {
+	switch driver {
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	case DriverMySQL:
+		return &SnippetModel{DB: db, QueryTimeout: queryTimeout}, nil
+	case DriverSQLite:
+		return &SnippetModel{DB: db, Dialect: DialectSQLite, QueryTimeout: queryTimeout}, nil
+	}
+
+	return nil, fmt.Errorf("database: unsupported driver %q", driver)
+}
+
+// NewUserStore returns the UserStore for driver, like NewStore.
+func NewUserStore(driver string, db *sql.DB, queryTimeout time.Duration) (UserStore, error) {
+	switch driver {
+	case DriverMemory:
+		return NewMemoryUserStore(), nil
+	case DriverMySQL:
+		return &UserModel{DB: db, QueryTimeout: queryTimeout}, nil
+	case DriverSQLite:
+		return &UserModel{DB: db, Dialect: DialectSQLite, QueryTimeout: queryTimeout}, nil
+	}
+
+	return nil, fmt.Errorf("database: unsupported driver %q", driver)
+}
+
+// NewTokenStore returns the TokenStore for driver, like NewStore.
+func NewTokenStore(driver string, db *sql.DB, queryTimeout time.Duration) (TokenStore, error) {
+	switch driver {
+	case DriverMemory:
+		return NewMemoryTokenStore(), nil
+	case DriverMySQL:
+		return &TokenModel{DB: db, QueryTimeout: queryTimeout}, nil
+	case DriverSQLite:
+		return &TokenModel{DB: db, Dialect: DialectSQLite, QueryTimeout: queryTimeout}, nil
+	}
+
+	return nil, fmt.Errorf("database: unsupported driver %q", driver)
+}
+
+// queryContext derives the context for a single query, adding timeout to
+// whatever deadline ctx already has.
+func queryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func sqliteDSN(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return dsn + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
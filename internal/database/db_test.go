@@ -0,0 +1,82 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		name       string
+		driver     string
+		dsn        string
+		wantDriver string
+		wantDSN    string
+		expectErr  bool
+	}{
+		{
+			name:       "MySQL DSN without scheme defaults to mysql",
+			dsn:        "web:pass@/snippetbox?parseTime=true",
+			wantDriver: database.DriverMySQL,
+			wantDSN:    "web:pass@/snippetbox?parseTime=true",
+		},
+		{
+			name:       "sqlite scheme selects sqlite",
+			dsn:        "sqlite://snippetbox.db",
+			wantDriver: database.DriverSQLite,
+			wantDSN:    "snippetbox.db",
+		},
+		{
+			name:       "mysql scheme is stripped",
+			dsn:        "mysql://web:pass@/snippetbox",
+			wantDriver: database.DriverMySQL,
+			wantDSN:    "web:pass@/snippetbox",
+		},
+		{
+			name:       "memory scheme selects the in-memory store",
+			dsn:        "memory://",
+			wantDriver: database.DriverMemory,
+			wantDSN:    "",
+		},
+		{
+			name:       "explicit driver without scheme",
+			driver:     database.DriverSQLite,
+			dsn:        "snippetbox.db",
+			wantDriver: database.DriverSQLite,
+			wantDSN:    "snippetbox.db",
+		},
+		{
+			name:      "driver and scheme disagree",
+			driver:    database.DriverMySQL,
+			dsn:       "sqlite://snippetbox.db",
+			expectErr: true,
+		},
+		{
+			name:      "unsupported driver",
+			driver:    "postgres",
+			dsn:       "snippetbox",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDriver, gotDSN, err := database.ParseDSN(tt.driver, tt.dsn)
+			if tt.expectErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if gotDriver != tt.wantDriver || gotDSN != tt.wantDSN {
+				t.Errorf("got (%q, %q), want (%q, %q)", gotDriver, gotDSN, tt.wantDriver, tt.wantDSN)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect is the SQL that differs between the databases the models speak.
+// Everything else, placeholders included, is shared.
+type Dialect struct {
+	// now is the current UTC time.
+	now string
+	// daysFromNow is the time the number of days bound to ? from now.
+	daysFromNow string
+	// deleteExpired removes up to ? snippets that expire at or before ?.
+	deleteExpired string
+	// time converts a time parameter to compare with a stored one.
+	time func(time.Time) any
+	// match returns the condition selecting snippets with a word starting
+	// with every term, and its arguments.
+	match func(terms []string) (string, []any)
+	// duplicateEmail reports whether an insert failed on the unique email.
+	duplicateEmail func(error) bool
+}
+
+// DialectMySQL is the dialect of MySQL, which models default to.
+var DialectMySQL = &Dialect{
+	now:           "UTC_TIMESTAMP()",
+	daysFromNow:   "DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY)",
+	deleteExpired: `DELETE FROM snippets WHERE expires <= ? ORDER BY id LIMIT ?`,
+	time: func(t time.Time) any {
+		return t.UTC()
+	},
+	match: mysqlMatch,
+	duplicateEmail: func(err error) bool {
+		var mySQLError *mysql.MySQLError
+		return errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email")
+	},
+}
+
+// mysqlMinTokenSize and mysqlStopwords are InnoDB's defaults for which words
+// a FULLTEXT index leaves out.
+const mysqlMinTokenSize = 3
+
+var mysqlStopwords = words("a about an are as at be by com de en for from how i in is it la of on or that the this to was what when where who will with und www")
+
+// mysqlMatch searches the FULLTEXT index, where boolean mode with +term*
+// requires every term, matching it as a prefix. Terms the index cannot hold
+// fall back to a regular expression for a word starting with them, which
+// scans every row but finds the same snippets the other stores do.
+func mysqlMatch(terms []string) (string, []any) {
+	conditions := []string{}
+	args := []any{}
+	against := []string{}
+
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < mysqlMinTokenSize || mysqlStopwords[term] {
+			conditions = append(conditions, "CONCAT_WS(' ', title, content) REGEXP ?")
+			args = append(args, `\b`+term)
+			continue
+		}
+
+		against = append(against, "+"+term+"*")
+	}
+
+	if len(against) > 0 {
+		conditions = append([]string{"MATCH(title, content) AGAINST(? IN BOOLEAN MODE)"}, conditions...)
+		args = append([]any{strings.Join(against, " ")}, args...)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// DialectSQLite is the dialect of an embedded SQLite database.
+var DialectSQLite = &Dialect{
+	now:         "datetime('now')",
+	daysFromNow: "datetime('now', ? || ' days')",
+	// SQLite has no DELETE ... LIMIT by default, so pick the ids first.
+	deleteExpired: `DELETE FROM snippets WHERE id IN (SELECT id FROM snippets WHERE expires <= ? ORDER BY id LIMIT ?)`,
+	// Times are formatted the way datetime() writes them so the text compares.
+	time: func(t time.Time) any {
+		return t.UTC().Format(time.DateTime)
+	},
+	match: func(terms []string) (string, []any) {
+		// Space separated "term"* phrases must all match, each as a prefix.
+		match := []string{}
+		for _, term := range terms {
+			match = append(match, `"`+term+`"*`)
+		}
+
+		return "id IN (SELECT rowid FROM snippets_fts WHERE snippets_fts MATCH ?)", []any{strings.Join(match, " ")}
+	},
+	duplicateEmail: func(err error) bool {
+		var sqliteError *sqlite.Error
+		return errors.As(err, &sqliteError) && sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+}
+
+// dialectOr returns d, or MySQL for the zero value of a model.
+func dialectOr(d *Dialect) *Dialect {
+	if d == nil {
+		return DialectMySQL
+	}
+
+	return d
+}
+
+func words(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+
+	return set
+}
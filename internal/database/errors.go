@@ -1,8 +1,29 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"fmt"
 )
 
 var ErrNoRecord = errors.New("database: no matching record found")
 var ErrGeneric = errors.New("database: generic error")
+var ErrCanceled = errors.New("database: query canceled")
+var ErrTimeout = errors.New("database: query timed out")
+var ErrInvalidCredentials = errors.New("database: invalid credentials")
+var ErrDuplicateEmail = errors.New("database: duplicate email")
+var ErrInvalidToken = errors.New("database: invalid or expired token")
+
+// contextError maps a failure caused by ctx ending onto ErrCanceled or
+// ErrTimeout, keeping the original error in the chain. Drivers do not always
+// return ctx.Err() itself, so ctx is checked as well as err.
+func contextError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, context.Canceled), errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+
+	return err
+}
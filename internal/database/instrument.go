@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Observer is told how long each call to an instrumented store took and the
+// error it returned, if any. store is "snippets", "users" or "tokens" and
+// operation the method called, in snake case.
+type Observer func(store string, operation string, took time.Duration, err error)
+
+// InstrumentStore returns a Store that reports every call to store to
+// observe.
+func InstrumentStore(store Store, observe Observer) Store {
+	return &instrumentedStore{next: store, observe: observe}
+}
+
+// InstrumentUserStore is InstrumentStore for a UserStore.
+func InstrumentUserStore(store UserStore, observe Observer) UserStore {
+	return &instrumentedUserStore{next: store, observe: observe}
+}
+
+// InstrumentTokenStore is InstrumentStore for a TokenStore.
+func InstrumentTokenStore(store TokenStore, observe Observer) TokenStore {
+	return &instrumentedTokenStore{next: store, observe: observe}
+}
+
+// observeCall is deferred at the start of an instrumented method, with err
+// pointing at its named result.
+func observeCall(observe Observer, store string, operation string, start time.Time, err *error) {
+	observe(store, operation, time.Since(start), *err)
+}
+
+type instrumentedStore struct {
+	next    Store
+	observe Observer
+}
+
+func (s *instrumentedStore) Insert(ctx context.Context, title string, content string, language string, expires int, userID int) (id int, err error) {
+	defer observeCall(s.observe, "snippets", "insert", time.Now(), &err)
+	return s.next.Insert(ctx, title, content, language, expires, userID)
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, id int) (snippet *Snippet, err error) {
+	defer observeCall(s.observe, "snippets", "get", time.Now(), &err)
+	return s.next.Get(ctx, id)
+}
+
+func (s *instrumentedStore) GetRevision(ctx context.Context, id int, revision int) (snippet *Snippet, err error) {
+	defer observeCall(s.observe, "snippets", "get_revision", time.Now(), &err)
+	return s.next.GetRevision(ctx, id, revision)
+}
+
+func (s *instrumentedStore) Revisions(ctx context.Context, id int) (revisions []*Revision, err error) {
+	defer observeCall(s.observe, "snippets", "revisions", time.Now(), &err)
+	return s.next.Revisions(ctx, id)
+}
+
+func (s *instrumentedStore) Latest(ctx context.Context, cursor Cursor) (snippets []*Snippet, err error) {
+	defer observeCall(s.observe, "snippets", "latest", time.Now(), &err)
+	return s.next.Latest(ctx, cursor)
+}
+
+func (s *instrumentedStore) Search(ctx context.Context, query string, cursor Cursor) (snippets []*Snippet, err error) {
+	defer observeCall(s.observe, "snippets", "search", time.Now(), &err)
+	return s.next.Search(ctx, query, cursor)
+}
+
+func (s *instrumentedStore) Update(ctx context.Context, id int, title string, content string, language string, expires int) (err error) {
+	defer observeCall(s.observe, "snippets", "update", time.Now(), &err)
+	return s.next.Update(ctx, id, title, content, language, expires)
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, id int) (err error) {
+	defer observeCall(s.observe, "snippets", "delete", time.Now(), &err)
+	return s.next.Delete(ctx, id)
+}
+
+func (s *instrumentedStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (deleted int, err error) {
+	defer observeCall(s.observe, "snippets", "delete_expired", time.Now(), &err)
+	return s.next.DeleteExpired(ctx, before, limit)
+}
+
+func (s *instrumentedStore) Count(ctx context.Context) (count int, err error) {
+	defer observeCall(s.observe, "snippets", "count", time.Now(), &err)
+	return s.next.Count(ctx)
+}
+
+type instrumentedUserStore struct {
+	next    UserStore
+	observe Observer
+}
+
+func (s *instrumentedUserStore) Insert(ctx context.Context, name string, email string, password string) (id int, err error) {
+	defer observeCall(s.observe, "users", "insert", time.Now(), &err)
+	return s.next.Insert(ctx, name, email, password)
+}
+
+func (s *instrumentedUserStore) Authenticate(ctx context.Context, email string, password string) (id int, err error) {
+	defer observeCall(s.observe, "users", "authenticate", time.Now(), &err)
+	return s.next.Authenticate(ctx, email, password)
+}
+
+func (s *instrumentedUserStore) Get(ctx context.Context, id int) (user *User, err error) {
+	defer observeCall(s.observe, "users", "get", time.Now(), &err)
+	return s.next.Get(ctx, id)
+}
+
+type instrumentedTokenStore struct {
+	next    TokenStore
+	observe Observer
+}
+
+func (s *instrumentedTokenStore) Insert(ctx context.Context, userID int, name string, scopes []string, expires time.Time) (plaintext string, err error) {
+	defer observeCall(s.observe, "tokens", "insert", time.Now(), &err)
+	return s.next.Insert(ctx, userID, name, scopes, expires)
+}
+
+func (s *instrumentedTokenStore) Authenticate(ctx context.Context, plaintext string) (token *Token, err error) {
+	defer observeCall(s.observe, "tokens", "authenticate", time.Now(), &err)
+	return s.next.Authenticate(ctx, plaintext)
+}
+
+func (s *instrumentedTokenStore) ForUser(ctx context.Context, userID int) (tokens []*Token, err error) {
+	defer observeCall(s.observe, "tokens", "for_user", time.Now(), &err)
+	return s.next.ForUser(ctx, userID)
+}
+
+func (s *instrumentedTokenStore) Delete(ctx context.Context, userID int, id int) (err error) {
+	defer observeCall(s.observe, "tokens", "delete", time.Now(), &err)
+	return s.next.Delete(ctx, userID, id)
+}
@@ -0,0 +1,63 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/database/storetest"
+)
+
+func ignoreCall(string, string, time.Duration, error) {}
+
+func TestInstrumentedStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return database.InstrumentStore(database.NewMemoryStore(), ignoreCall)
+	})
+
+	storetest.RunUsers(t, func(t *testing.T) database.UserStore {
+		return database.InstrumentUserStore(database.NewMemoryUserStore(), ignoreCall)
+	})
+
+	storetest.RunTokens(t, func(t *testing.T) (database.UserStore, database.TokenStore) {
+		return database.NewMemoryUserStore(), database.InstrumentTokenStore(database.NewMemoryTokenStore(), ignoreCall)
+	})
+
+	t.Run("every call is observed with its error", func(t *testing.T) {
+		type call struct {
+			store     string
+			operation string
+			err       error
+		}
+
+		var calls []call
+		store := database.InstrumentStore(database.NewMemoryStore(), func(store, operation string, took time.Duration, err error) {
+			if took < 0 {
+				t.Errorf("got negative duration %v", took)
+			}
+			calls = append(calls, call{store, operation, err})
+		})
+
+		id, _ := store.Insert(context.Background(), "title", "content", "", 1, 0)
+		store.Get(context.Background(), id+1)
+		store.DeleteExpired(context.Background(), time.Now(), 10)
+
+		want := []call{
+			{"snippets", "insert", nil},
+			{"snippets", "get", database.ErrNoRecord},
+			{"snippets", "delete_expired", nil},
+		}
+
+		if len(calls) != len(want) {
+			t.Fatalf("got calls %v, want %v", calls, want)
+		}
+
+		for i := range want {
+			if calls[i].store != want[i].store || calls[i].operation != want[i].operation || !errors.Is(calls[i].err, want[i].err) {
+				t.Errorf("got call %v, want %v", calls[i], want[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,545 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryStore is a Store that keeps snippets in process memory. Nothing
+// survives a restart, which makes it handy for development and tests.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	lastID    int
+	snippets  []*Snippet // ordered by ascending ID
+	revisions map[int][]*Revision
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{revisions: map[int][]*Revision{}}
+}
+
+func (m *MemoryStore) Insert(ctx context.Context, title string, content string, language string, expires int, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created := time.Now().UTC().Truncate(time.Second)
+
+	m.lastID++
+	snippet := &Snippet{
+		ID:       m.lastID,
+		Title:    title,
+		Content:  content,
+		Language: language,
+		Created:  created,
+		Expires:  created.AddDate(0, 0, expires),
+		Revision: 1,
+		UserID:   userID,
+	}
+	m.snippets = append(m.snippets, snippet)
+	m.saveRevision(snippet)
+
+	return m.lastID, nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id int) (*Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.live(id)
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	snippet := *m.snippets[i]
+
+	return &snippet, nil
+}
+
+// GetRevision returns a live snippet with the title and content it had at
+// the given revision.
+func (m *MemoryStore) GetRevision(ctx context.Context, id int, revision int) (*Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.live(id)
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	for _, r := range m.revisions[id] {
+		if r.Revision == revision {
+			snippet := *m.snippets[i]
+			snippet.Title = r.Title
+			snippet.Content = r.Content
+			snippet.Revision = r.Revision
+
+			return &snippet, nil
+		}
+	}
+
+	return nil, ErrNoRecord
+}
+
+// Revisions returns every version of a live snippet, newest first.
+func (m *MemoryStore) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.live(id); !ok {
+		return nil, ErrNoRecord
+	}
+
+	saved := m.revisions[id]
+	revisions := []*Revision{}
+
+	for i := len(saved) - 1; i >= 0; i-- {
+		revision := *saved[i]
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, nil
+}
+
+// Latest returns the page of live snippets selected by cursor
+func (m *MemoryStore) Latest(ctx context.Context, cursor Cursor) ([]*Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.page(cursor, func(*Snippet) bool { return true }), nil
+}
+
+// Search returns the page of live snippets selected by cursor whose title or
+// content has a word starting with every term in query.
+func (m *MemoryStore) Search(ctx context.Context, query string, cursor Cursor) ([]*Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []*Snippet{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.page(cursor, func(snippet *Snippet) bool {
+		return matchesTerms(snippet.Title+"\n"+snippet.Content, terms)
+	}), nil
+}
+
+// Update replaces the title, content and language of a live snippet, saving
+// the title and content as a new revision, and sets it to expire the given
+// number of days from now.
+func (m *MemoryStore) Update(ctx context.Context, id int, title string, content string, language string, expires int) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.live(id)
+	if !ok {
+		return ErrNoRecord
+	}
+
+	// Replace rather than modify, so snippets already handed out by Get
+	// stay as they were.
+	snippet := *m.snippets[i]
+	snippet.Title = title
+	snippet.Content = content
+	snippet.Language = language
+	snippet.Expires = time.Now().UTC().Truncate(time.Second).AddDate(0, 0, expires)
+	snippet.Revision++
+	m.snippets[i] = &snippet
+	m.saveRevision(&snippet)
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.live(id)
+	if !ok {
+		return ErrNoRecord
+	}
+
+	// slices.Delete clears the freed slot so the snippet can be garbage
+	// collected.
+	m.snippets = slices.Delete(m.snippets, i, i+1)
+	delete(m.revisions, id)
+
+	return nil
+}
+
+// DeleteExpired removes up to limit snippets that expired at or before the
+// given time, returning how many it removed.
+func (m *MemoryStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.snippets[:0]
+	deleted := 0
+
+	for _, snippet := range m.snippets {
+		if deleted < limit && !snippet.Expires.After(before) {
+			delete(m.revisions, snippet.ID)
+			deleted++
+			continue
+		}
+		kept = append(kept, snippet)
+	}
+
+	// Clear the tail so removed snippets can be garbage collected.
+	clear(m.snippets[len(kept):])
+	m.snippets = kept
+
+	return deleted, nil
+}
+
+// Count returns how many live snippets there are.
+func (m *MemoryStore) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+
+	for _, snippet := range m.snippets {
+		if snippet.Expires.After(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// page returns copies of the live snippets that match and fall within
+// cursor, newest first.
+func (m *MemoryStore) page(cursor Cursor, match func(*Snippet) bool) []*Snippet {
+	now := time.Now()
+	snippets := []*Snippet{}
+
+	inPage := func(snippet *Snippet) bool {
+		return snippet.Expires.After(now) &&
+			(cursor.Before == 0 || snippet.ID < cursor.Before) &&
+			(cursor.After == 0 || snippet.ID > cursor.After) &&
+			match(snippet)
+	}
+
+	if cursor.After > 0 {
+		for i := 0; i < len(m.snippets) && len(snippets) < cursor.Limit; i++ {
+			if inPage(m.snippets[i]) {
+				snippet := *m.snippets[i]
+				snippets = append(snippets, &snippet)
+			}
+		}
+		slices.Reverse(snippets)
+
+		return snippets
+	}
+
+	for i := len(m.snippets) - 1; i >= 0 && len(snippets) < cursor.Limit; i-- {
+		if inPage(m.snippets[i]) {
+			snippet := *m.snippets[i]
+			snippets = append(snippets, &snippet)
+		}
+	}
+
+	return snippets
+}
+
+// saveRevision records the current state of snippet. The caller must hold
+// the write lock.
+func (m *MemoryStore) saveRevision(snippet *Snippet) {
+	m.revisions[snippet.ID] = append(m.revisions[snippet.ID], &Revision{
+		SnippetID: snippet.ID,
+		Revision:  snippet.Revision,
+		Title:     snippet.Title,
+		Content:   snippet.Content,
+		Created:   time.Now().UTC().Truncate(time.Second),
+	})
+}
+
+// live returns the index of the snippet with the given ID, and whether it
+// exists and has not yet expired.
+func (m *MemoryStore) live(id int) (int, bool) {
+	i := m.search(id)
+	if i == len(m.snippets) || m.snippets[i].ID != id || !m.snippets[i].Expires.After(time.Now()) {
+		return i, false
+	}
+
+	return i, true
+}
+
+// search returns the index of the snippet with the given ID, or where it
+// would be inserted if there is none.
+func (m *MemoryStore) search(id int) int {
+	return sort.Search(len(m.snippets), func(i int) bool {
+		return m.snippets[i].ID >= id
+	})
+}
+
+// MemoryUserStore is a UserStore that keeps accounts in process memory.
+type MemoryUserStore struct {
+	mu     sync.RWMutex
+	lastID int
+	users  []*User
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{}
+}
+
+func (m *MemoryUserStore) Insert(ctx context.Context, name string, email string, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.byEmail(email) != nil {
+		return 0, ErrDuplicateEmail
+	}
+
+	m.lastID++
+	m.users = append(m.users, &User{
+		ID:             m.lastID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC().Truncate(time.Second),
+	})
+
+	return m.lastID, nil
+}
+
+// Authenticate returns the id of the user with the given email and password.
+func (m *MemoryUserStore) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	user := m.byEmail(email)
+	m.mu.RUnlock()
+
+	if user == nil {
+		return 0, ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		} else {
+			return 0, err
+		}
+	}
+
+	return user.ID, nil
+}
+
+func (m *MemoryUserStore) Get(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.ID == id {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, ErrNoRecord
+}
+
+// byEmail finds a user ignoring case, as the SQL backends do.
+func (m *MemoryUserStore) byEmail(email string) *User {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// MemoryTokenStore is a TokenStore that keeps API tokens in process memory.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	lastID int
+	tokens []*memoryToken
+}
+
+type memoryToken struct {
+	Token
+	hash []byte
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+// Insert creates a token for the user and returns its plaintext. A zero
+// expires makes a token that never expires.
+func (m *MemoryTokenStore) Insert(ctx context.Context, userID int, name string, scopes []string, expires time.Time) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", contextError(ctx, err)
+	}
+
+	plaintext, hash, err := newTokenSecret()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	m.tokens = append(m.tokens, &memoryToken{
+		Token: Token{
+			ID:      m.lastID,
+			UserID:  userID,
+			Name:    name,
+			Scopes:  slices.Clone(scopes),
+			Created: time.Now().UTC().Truncate(time.Second),
+			Expires: truncateTime(expires),
+		},
+		hash: hash,
+	})
+
+	return plaintext, nil
+}
+
+// Authenticate returns the live token with the given plaintext and records
+// that it was used. LastUsed on the returned token is the use before this one.
+func (m *MemoryTokenStore) Authenticate(ctx context.Context, plaintext string) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	hash := hashToken(plaintext)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.tokens {
+		if bytes.Equal(token.hash, hash) && !token.Expired(now) {
+			found := copyToken(&token.Token)
+			token.LastUsed = now.UTC().Truncate(time.Second)
+			return found, nil
+		}
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// ForUser returns every token of the user, expired ones included, newest
+// first.
+func (m *MemoryTokenStore) ForUser(ctx context.Context, userID int) ([]*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := []*Token{}
+	for i := len(m.tokens) - 1; i >= 0; i-- {
+		if m.tokens[i].UserID == userID {
+			tokens = append(tokens, copyToken(&m.tokens[i].Token))
+		}
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes one of the user's tokens.
+func (m *MemoryTokenStore) Delete(ctx context.Context, userID int, id int) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, token := range m.tokens {
+		if token.ID == id && token.UserID == userID {
+			m.tokens = slices.Delete(m.tokens, i, i+1)
+			return nil
+		}
+	}
+
+	return ErrNoRecord
+}
+
+func copyToken(token *Token) *Token {
+	copied := *token
+	copied.Scopes = slices.Clone(token.Scopes)
+	return &copied
+}
+
+// truncateTime drops the sub-second part as the SQL backends do, keeping the
+// zero time zero.
+func truncateTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,69 @@
+package database_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/database/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return database.NewMemoryStore()
+	})
+
+	t.Run("returned snippets cannot modify the store", func(t *testing.T) {
+		testSnippetStore := database.NewMemoryStore()
+
+		id, _ := testSnippetStore.Insert(context.Background(), "title", "content", "", 1, 0)
+
+		snippet, _ := testSnippetStore.Get(context.Background(), id)
+		snippet.Title = "changed"
+
+		gotSnippet, _ := testSnippetStore.Get(context.Background(), id)
+		if gotSnippet.Title != "title" {
+			t.Errorf("got title %q, want %q", gotSnippet.Title, "title")
+		}
+	})
+
+	t.Run("concurrent inserts get unique ids", func(t *testing.T) {
+		testSnippetStore := database.NewMemoryStore()
+
+		var wg sync.WaitGroup
+		ids := make(chan int, 50)
+
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id, _ := testSnippetStore.Insert(context.Background(), "title", "content", "", 1, 0)
+				ids <- id
+			}()
+		}
+
+		wg.Wait()
+		close(ids)
+
+		seen := map[int]bool{}
+		for id := range ids {
+			if seen[id] {
+				t.Errorf("id %d handed out more than once", id)
+			}
+			seen[id] = true
+		}
+	})
+}
+
+func TestMemoryUserStore(t *testing.T) {
+	storetest.RunUsers(t, func(t *testing.T) database.UserStore {
+		return database.NewMemoryUserStore()
+	})
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	storetest.RunTokens(t, func(t *testing.T) (database.UserStore, database.TokenStore) {
+		return database.NewMemoryUserStore(), database.NewMemoryTokenStore()
+	})
+}
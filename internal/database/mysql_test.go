@@ -0,0 +1,61 @@
+package database_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/database/storetest"
+	"github.com/andremfp/snippetbox/internal/migrations"
+)
+
+// TestSnippetModelConformance runs the Store suite against a real MySQL
+// server. Point SNIPPETBOX_TEST_MYSQL_DSN at a throwaway database, e.g.
+// "test_web:pass@/test_snippetbox?parseTime=true", as every table in it is
+// dropped and recreated.
+func TestSnippetModelConformance(t *testing.T) {
+	dsn := os.Getenv("SNIPPETBOX_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_MYSQL_DSN not set")
+	}
+
+	db, err := database.OpenDB(database.DriverMySQL, dsn)
+	if err != nil {
+		t.Fatalf("could not open mysql db, %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, database.DriverMySQL)
+	if err != nil {
+		t.Fatalf("could not load migrations, %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		resetMySQL(t, migrator)
+		return &database.SnippetModel{DB: db}
+	})
+
+	storetest.RunUsers(t, func(t *testing.T) database.UserStore {
+		resetMySQL(t, migrator)
+		return &database.UserModel{DB: db}
+	})
+
+	storetest.RunTokens(t, func(t *testing.T) (database.UserStore, database.TokenStore) {
+		resetMySQL(t, migrator)
+		return &database.UserModel{DB: db}, &database.TokenModel{DB: db}
+	})
+}
+
+// resetMySQL drops every table and migrates back up, so each subtest starts
+// from an empty database.
+func resetMySQL(t *testing.T, migrator *migrations.Migrator) {
+	t.Helper()
+
+	if _, err := migrator.Down(len(migrator.Migrations)); err != nil {
+		t.Fatalf("could not reset mysql db, %v", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("could not migrate mysql db, %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchTerms splits a search query into the lower-cased words every match
+// must contain. Anything other than letters and digits separates words, which
+// also keeps the MySQL and FTS5 query syntax out of user input.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), notWordRune)
+}
+
+// matchesTerms reports whether some word in text starts with every term.
+func matchesTerms(text string, terms []string) bool {
+	words := SearchTerms(text)
+
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -1,51 +1,91 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"slices"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
+// Store is the snippet persistence used by the handlers. Implementations
+// report a missing or expired snippet as ErrNoRecord, and a query cut short
+// by its context as ErrCanceled or ErrTimeout.
 type Store interface {
-	Insert(title string, content string, expires int) (int, error)
-	Get(id int) (*Snippet, error)
-	Latest() ([]*Snippet, error)
+	Insert(ctx context.Context, title string, content string, language string, expires int, userID int) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	GetRevision(ctx context.Context, id int, revision int) (*Snippet, error)
+	Revisions(ctx context.Context, id int) ([]*Revision, error)
+	Latest(ctx context.Context, cursor Cursor) ([]*Snippet, error)
+	Search(ctx context.Context, query string, cursor Cursor) ([]*Snippet, error)
+	Update(ctx context.Context, id int, title string, content string, language string, expires int) error
+	Delete(ctx context.Context, id int) error
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error)
+	Count(ctx context.Context) (int, error)
 }
 
+// Snippet is a published snippet. UserID is the author, or 0 for snippets
+// posted before there were user accounts. Language names the syntax of
+// Content, empty for plain text; it belongs to the snippet rather than to
+// a revision.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID       int
+	Title    string
+	Content  string
+	Language string
+	Created  time.Time
+	Expires  time.Time
+	Revision int
+	UserID   int
+}
+
+// Revision is one saved version of a snippet. Revision 1 is the snippet as
+// first published, and every edit adds the next one.
+type Revision struct {
+	SnippetID int
+	Revision  int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// Cursor selects one page of live snippets by ID. Before returns the Limit
+// snippets just older than it and After the Limit snippets just newer, and
+// zero for both starts from the newest. Pages are always newest first.
+type Cursor struct {
+	Before int
+	After  int
+	Limit  int
 }
 
+// SnippetModel is the Store backed by a SQL database.
 type SnippetModel struct {
 	DB *sql.DB
+	// Dialect is the SQL the database speaks, MySQL if nil.
+	Dialect *Dialect
+	// QueryTimeout bounds every query on top of the caller's context. Zero
+	// means no extra limit.
+	QueryTimeout time.Duration
 }
 
-func OpenDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, language string, expires int, userID int) (int, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
 
-	if err = db.Ping(); err != nil {
-		return nil, err
-	}
+	d := dialectOr(m.Dialect)
 
-	return db, nil
-}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+	defer tx.Rollback()
 
-	stmt := `INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (title, content, language, created, expires, user_id) VALUES(?, ?, ?, ` + d.now + `, ` + d.daysFromNow + `, ?)`
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := tx.ExecContext(ctx, stmt, title, content, language, expires, authorID(userID))
 	if err != nil {
-		return 0, err
+		return 0, contextError(ctx, err)
 	}
 
 	id, err := result.LastInsertId()
@@ -53,37 +93,313 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 		return 0, err
 	}
 
+	if err = m.saveRevision(ctx, tx, int(id)); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
 	return int(id), nil
 }
 
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-			WHERE expires > UTC_TIMESTAMP() AND id = ?`
+func (m *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets
+			WHERE expires > ` + d.now + ` AND id = ?`
 
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRowContext(ctx, stmt, id)
 
 	snippet := &Snippet{}
 
-	err := row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
+	err := row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Language, &snippet.Created, &snippet.Expires, &snippet.Revision, &snippet.UserID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		} else {
-			return nil, err
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return snippet, nil
+}
+
+// GetRevision returns a live snippet with the title and content it had at
+// the given revision.
+func (m *SnippetModel) GetRevision(ctx context.Context, id int, revision int) (*Snippet, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `SELECT s.id, r.title, r.content, s.language, s.created, s.expires, r.revision, COALESCE(s.user_id, 0) FROM snippets s
+			JOIN snippet_revisions r ON r.snippet_id = s.id
+			WHERE s.expires > ` + d.now + ` AND s.id = ? AND r.revision = ?`
+
+	row := m.DB.QueryRowContext(ctx, stmt, id, revision)
+
+	snippet := &Snippet{}
+
+	err := row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Language, &snippet.Created, &snippet.Expires, &snippet.Revision, &snippet.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, contextError(ctx, err)
 		}
 	}
 
 	return snippet, nil
 }
 
-// Return the 10 most recently created snippets
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// Revisions returns every version of a live snippet, newest first.
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
 
-	rows, err := m.DB.Query(stmt)
+	stmt := `SELECT r.snippet_id, r.revision, r.title, r.content, r.created FROM snippet_revisions r
+			JOIN snippets s ON s.id = r.snippet_id
+			WHERE s.expires > ` + d.now + ` AND r.snippet_id = ? ORDER BY r.revision DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		revision := &Revision{}
+
+		err := rows.Scan(&revision.SnippetID, &revision.Revision, &revision.Title, &revision.Content, &revision.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNoRecord
+	}
+
+	return revisions, nil
+}
+
+// Latest returns the page of live snippets selected by cursor
+func (m *SnippetModel) Latest(ctx context.Context, cursor Cursor) ([]*Snippet, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt, args := pageQuery(d.now, cursor, "")
+
+	return queryPage(ctx, m.DB, stmt, args, cursor)
+}
+
+// Search returns the page of live snippets selected by cursor whose title or
+// content has a word starting with every term in query.
+func (m *SnippetModel) Search(ctx context.Context, query string, cursor Cursor) ([]*Snippet, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []*Snippet{}, nil
+	}
+
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	filter, filterArgs := d.match(terms)
+	stmt, args := pageQuery(d.now, cursor, filter, filterArgs...)
+
+	return queryPage(ctx, m.DB, stmt, args, cursor)
+}
+
+// Update replaces the title, content and language of a live snippet, saving
+// the title and content as a new revision, and sets it to expire the given
+// number of days from now.
+func (m *SnippetModel) Update(ctx context.Context, id int, title string, content string, language string, expires int) error {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	// Bumping the revision means the row always changes, so MySQL, which
+	// only counts rows it actually changed, reports it even for a no-op edit.
+	stmt := `UPDATE snippets SET title = ?, content = ?, language = ?, expires = ` + d.daysFromNow + `, revision = revision + 1
+			WHERE expires > ` + d.now + ` AND id = ?`
+
+	result, err := tx.ExecContext(ctx, stmt, title, content, language, expires, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	if err = m.saveRevision(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `DELETE FROM snippets WHERE expires > ` + d.now + ` AND id = ?`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteExpired removes up to limit snippets that expired at or before the
+// given time, returning how many it removed.
+func (m *SnippetModel) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	result, err := m.DB.ExecContext(ctx, d.deleteExpired, d.time(before), limit)
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
+// Count returns how many live snippets there are.
+func (m *SnippetModel) Count(ctx context.Context) (int, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `SELECT COUNT(*) FROM snippets WHERE expires > ` + d.now
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, stmt).Scan(&count)
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// saveRevision copies the current state of a snippet into snippet_revisions.
+func (m *SnippetModel) saveRevision(ctx context.Context, tx *sql.Tx, id int) error {
+	d := dialectOr(m.Dialect)
+
+	stmt := `INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+			SELECT id, revision, title, content, ` + d.now + ` FROM snippets WHERE id = ?`
+
+	_, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return nil
+}
+
+// authorID stores the anonymous author 0 as NULL, which the users foreign
+// key allows.
+func authorID(userID int) any {
+	if userID == 0 {
+		return nil
+	}
+
+	return userID
+}
+
+// pageQuery builds the keyset query for one page of live snippets, with now
+// being the SQL for the current time and filter an optional extra condition.
+// Paging towards newer snippets has to sort ascending so the LIMIT keeps the
+// ones nearest to After, and queryPage puts them back newest first.
+func pageQuery(now string, cursor Cursor, filter string, filterArgs ...any) (string, []any) {
+	stmt := `SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > ` + now
+	args := []any{}
+
+	if filter != "" {
+		stmt += ` AND ` + filter
+		args = append(args, filterArgs...)
+	}
+
+	if cursor.Before > 0 {
+		stmt += ` AND id < ?`
+		args = append(args, cursor.Before)
+	}
+
+	if cursor.After > 0 {
+		stmt += ` AND id > ? ORDER BY id ASC LIMIT ?`
+		args = append(args, cursor.After)
+	} else {
+		stmt += ` ORDER BY id DESC LIMIT ?`
+	}
+
+	return stmt, append(args, cursor.Limit)
+}
+
+// queryPage runs a query built by pageQuery and returns its snippets newest
+// first.
+func queryPage(ctx context.Context, db *sql.DB, stmt string, args []any, cursor Cursor) ([]*Snippet, error) {
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, contextError(ctx, err)
 	}
 
 	defer rows.Close()
@@ -93,7 +409,7 @@ WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
 	for rows.Next() {
 		snippet := &Snippet{}
 
-		err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
+		err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Language, &snippet.Created, &snippet.Expires, &snippet.Revision, &snippet.UserID)
 		if err != nil {
 			return nil, err
 		}
@@ -103,7 +419,11 @@ WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
 
 	// Check any errors during previous iteration
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
+	}
+
+	if cursor.After > 0 {
+		slices.Reverse(snippets)
 	}
 
 	return snippets, nil
@@ -1,6 +1,7 @@
 package database_test
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"regexp"
@@ -17,11 +18,15 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))")
+		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, language, created, expires, user_id) VALUES(?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?)")
+		revisionStmt := regexp.QuoteMeta("INSERT INTO snippet_revisions (snippet_id, revision, title, content, created) SELECT id, revision, title, content, UTC_TIMESTAMP() FROM snippets WHERE id = ?")
 
-		mock.ExpectExec(stmt).WithArgs("title", "content", 7).WillReturnResult(sqlmock.NewResult(1, 0))
+		mock.ExpectBegin()
+		mock.ExpectExec(stmt).WithArgs("title", "content", "go", 7, 3).WillReturnResult(sqlmock.NewResult(1, 0))
+		mock.ExpectExec(revisionStmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
-		gotID, _ := testSnippetStore.Insert("title", "content", 7)
+		gotID, _ := testSnippetStore.Insert(context.Background(), "title", "content", "go", 7, 3)
 		wantID := 1
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
@@ -38,11 +43,13 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))")
+		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, language, created, expires, user_id) VALUES(?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?)")
 
-		mock.ExpectExec(stmt).WithArgs("title", "content", 7).WillReturnError(database.ErrGeneric)
+		mock.ExpectBegin()
+		mock.ExpectExec(stmt).WithArgs("title", "content", "", 7, nil).WillReturnError(database.ErrGeneric)
+		mock.ExpectRollback()
 
-		gotID, gotErr := testSnippetStore.Insert("title", "content", 7)
+		gotID, gotErr := testSnippetStore.Insert(context.Background(), "title", "content", "", 7, 0)
 		wantID := 0
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
@@ -62,11 +69,13 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))")
+		stmt := regexp.QuoteMeta("INSERT INTO snippets (title, content, language, created, expires, user_id) VALUES(?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?)")
 
-		mock.ExpectExec(stmt).WithArgs("title", "content", 7).WillReturnResult(sqlmock.NewErrorResult(database.ErrGeneric))
+		mock.ExpectBegin()
+		mock.ExpectExec(stmt).WithArgs("title", "content", "", 7, nil).WillReturnResult(sqlmock.NewErrorResult(database.ErrGeneric))
+		mock.ExpectRollback()
 
-		gotID, gotErr := testSnippetStore.Insert("title", "content", 7)
+		gotID, gotErr := testSnippetStore.Insert(context.Background(), "title", "content", "", 7, 0)
 		wantID := 0
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
@@ -90,20 +99,22 @@ func TestSnippetModel(t *testing.T) {
 		expiresDate := time.Now().AddDate(0, 0, +1)
 
 		wantSnippet := &database.Snippet{
-			ID:      1,
-			Title:   "title",
-			Content: "content",
-			Created: createdDate,
-			Expires: expiresDate,
+			ID:       1,
+			Title:    "title",
+			Content:  "content",
+			Language: "go",
+			Created:  createdDate,
+			Expires:  expiresDate,
+			Revision: 1,
 		}
 
-		mokedDbResponse := sqlmock.NewRows([]string{"id", "title", "content", "created", "expires"}).AddRow(1, "title", "content", createdDate, expiresDate)
+		mokedDbResponse := sqlmock.NewRows([]string{"id", "title", "content", "language", "created", "expires", "revision", "user_id"}).AddRow(1, "title", "content", "go", createdDate, expiresDate, 1, 0)
 
-		stmt := regexp.QuoteMeta("SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
 
 		mock.ExpectQuery(stmt).WithArgs(1).WillReturnRows(mokedDbResponse)
 
-		gotSnippet, _ := testSnippetStore.Get(1)
+		gotSnippet, _ := testSnippetStore.Get(context.Background(), 1)
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
 		}
@@ -117,11 +128,11 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
 
 		mock.ExpectQuery(stmt).WithArgs(10).WillReturnError(sql.ErrNoRows)
 
-		_, getErr := testSnippetStore.Get(10)
+		_, getErr := testSnippetStore.Get(context.Background(), 10)
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
 		}
@@ -137,11 +148,11 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
 
 		mock.ExpectQuery(stmt).WithArgs(1).WillReturnError(database.ErrGeneric)
 
-		_, gotErr := testSnippetStore.Get(1)
+		_, gotErr := testSnippetStore.Get(context.Background(), 1)
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
 		}
@@ -152,6 +163,43 @@ func TestSnippetModel(t *testing.T) {
 
 	})
 
+	t.Run("get snippet query timeout", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db, QueryTimeout: 10 * time.Millisecond}
+
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+
+		mock.ExpectQuery(stmt).WithArgs(1).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, gotErr := testSnippetStore.Get(context.Background(), 1)
+
+		if !errors.Is(gotErr, database.ErrTimeout) {
+			t.Errorf("got error %v, want %v", gotErr, database.ErrTimeout)
+		}
+
+	})
+
+	t.Run("get snippet with canceled context", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+
+		mock.ExpectQuery(stmt).WithArgs(1).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		_, gotErr := testSnippetStore.Get(ctx, 1)
+
+		if !errors.Is(gotErr, database.ErrCanceled) {
+			t.Errorf("got error %v, want %v", gotErr, database.ErrCanceled)
+		}
+
+	})
+
 	t.Run("get latest snippets successfully", func(t *testing.T) {
 		db, mock := setDbMock(t)
 		defer db.Close()
@@ -162,35 +210,35 @@ func TestSnippetModel(t *testing.T) {
 		expiredDate := time.Now().AddDate(0, 0, +1)
 
 		wantSnippets := []*database.Snippet{
-			{ID: 1, Title: "title1", Content: "content1", Created: createdDate, Expires: expiredDate},
-			{ID: 2, Title: "title2", Content: "content2", Created: createdDate, Expires: expiredDate},
-			{ID: 3, Title: "title3", Content: "content3", Created: createdDate, Expires: expiredDate},
-			{ID: 4, Title: "title4", Content: "content4", Created: createdDate, Expires: expiredDate},
-			{ID: 5, Title: "title5", Content: "content5", Created: createdDate, Expires: expiredDate},
-			{ID: 6, Title: "title6", Content: "content6", Created: createdDate, Expires: expiredDate},
-			{ID: 7, Title: "title7", Content: "content7", Created: createdDate, Expires: expiredDate},
-			{ID: 8, Title: "title8", Content: "content8", Created: createdDate, Expires: expiredDate},
-			{ID: 9, Title: "title9", Content: "content9", Created: createdDate, Expires: expiredDate},
-			{ID: 10, Title: "title10", Content: "content10", Created: createdDate, Expires: expiredDate},
+			{ID: 1, Title: "title1", Content: "content1", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 2, Title: "title2", Content: "content2", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 3, Title: "title3", Content: "content3", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 4, Title: "title4", Content: "content4", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 5, Title: "title5", Content: "content5", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 6, Title: "title6", Content: "content6", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 7, Title: "title7", Content: "content7", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 8, Title: "title8", Content: "content8", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 9, Title: "title9", Content: "content9", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 10, Title: "title10", Content: "content10", Created: createdDate, Expires: expiredDate, Revision: 1},
 		}
 
-		mokedDbResponse := sqlmock.NewRows([]string{"id", "title", "content", "created", "expires"}).
-			AddRow(1, "title1", "content1", createdDate, expiredDate).
-			AddRow(2, "title2", "content2", createdDate, expiredDate).
-			AddRow(3, "title3", "content3", createdDate, expiredDate).
-			AddRow(4, "title4", "content4", createdDate, expiredDate).
-			AddRow(5, "title5", "content5", createdDate, expiredDate).
-			AddRow(6, "title6", "content6", createdDate, expiredDate).
-			AddRow(7, "title7", "content7", createdDate, expiredDate).
-			AddRow(8, "title8", "content8", createdDate, expiredDate).
-			AddRow(9, "title9", "content9", createdDate, expiredDate).
-			AddRow(10, "title10", "content10", createdDate, expiredDate)
+		mokedDbResponse := sqlmock.NewRows([]string{"id", "title", "content", "language", "created", "expires", "revision", "user_id"}).
+			AddRow(1, "title1", "content1", "", createdDate, expiredDate, 1, 0).
+			AddRow(2, "title2", "content2", "", createdDate, expiredDate, 1, 0).
+			AddRow(3, "title3", "content3", "", createdDate, expiredDate, 1, 0).
+			AddRow(4, "title4", "content4", "", createdDate, expiredDate, 1, 0).
+			AddRow(5, "title5", "content5", "", createdDate, expiredDate, 1, 0).
+			AddRow(6, "title6", "content6", "", createdDate, expiredDate, 1, 0).
+			AddRow(7, "title7", "content7", "", createdDate, expiredDate, 1, 0).
+			AddRow(8, "title8", "content8", "", createdDate, expiredDate, 1, 0).
+			AddRow(9, "title9", "content9", "", createdDate, expiredDate, 1, 0).
+			AddRow(10, "title10", "content10", "", createdDate, expiredDate, 1, 0)
 
-		stmt := regexp.QuoteMeta("SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10")
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT ?")
 
-		mock.ExpectQuery(stmt).WillReturnRows(mokedDbResponse)
+		mock.ExpectQuery(stmt).WithArgs(10).WillReturnRows(mokedDbResponse)
 
-		gotSnippets, _ := testSnippetStore.Latest()
+		gotSnippets, _ := testSnippetStore.Latest(context.Background(), database.Cursor{Limit: 10})
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
 		}
@@ -204,11 +252,11 @@ func TestSnippetModel(t *testing.T) {
 		defer db.Close()
 		testSnippetStore := database.SnippetModel{DB: db}
 
-		stmt := regexp.QuoteMeta("SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10")
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT ?")
 
-		mock.ExpectQuery(stmt).WillReturnError(database.ErrGeneric)
+		mock.ExpectQuery(stmt).WithArgs(10).WillReturnError(database.ErrGeneric)
 
-		_, gotErr := testSnippetStore.Latest()
+		_, gotErr := testSnippetStore.Latest(context.Background(), database.Cursor{Limit: 10})
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("expected sql statement not met, %v", err)
 		}
@@ -219,6 +267,212 @@ func TestSnippetModel(t *testing.T) {
 
 	})
 
+	t.Run("get newer snippets after a cursor", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		createdDate := time.Now().AddDate(0, 0, -1)
+		expiredDate := time.Now().AddDate(0, 0, +1)
+
+		wantSnippets := []*database.Snippet{
+			{ID: 6, Title: "title6", Content: "content6", Created: createdDate, Expires: expiredDate, Revision: 1},
+			{ID: 5, Title: "title5", Content: "content5", Created: createdDate, Expires: expiredDate, Revision: 1},
+		}
+
+		mokedDbResponse := sqlmock.NewRows([]string{"id", "title", "content", "language", "created", "expires", "revision", "user_id"}).
+			AddRow(5, "title5", "content5", "", createdDate, expiredDate, 1, 0).
+			AddRow(6, "title6", "content6", "", createdDate, expiredDate, 1, 0)
+
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND id < ? AND id > ? ORDER BY id ASC LIMIT ?")
+
+		mock.ExpectQuery(stmt).WithArgs(9, 4, 2).WillReturnRows(mokedDbResponse)
+
+		gotSnippets, _ := testSnippetStore.Latest(context.Background(), database.Cursor{Before: 9, After: 4, Limit: 2})
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		assertSnippetList(t, gotSnippets, wantSnippets)
+
+	})
+
+	t.Run("search matches words the fulltext index leaves out by regexp", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND MATCH(title, content) AGAINST(? IN BOOLEAN MODE) AND CONCAT_WS(' ', title, content) REGEXP ? AND CONCAT_WS(' ', title, content) REGEXP ? ORDER BY id DESC LIMIT ?")
+
+		mock.ExpectQuery(stmt).WithArgs("+pond*", `\bgo`, `\bthe`, 10).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "language", "created", "expires", "revision", "user_id"}))
+
+		if _, err := testSnippetStore.Search(context.Background(), "go the pond", database.Cursor{Limit: 10}); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+	})
+
+	t.Run("search snippets requires every term as a prefix", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("SELECT id, title, content, language, created, expires, revision, COALESCE(user_id, 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND MATCH(title, content) AGAINST(? IN BOOLEAN MODE) ORDER BY id DESC LIMIT ?")
+
+		mock.ExpectQuery(stmt).WithArgs("+frog* +pond*", 10).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "language", "created", "expires", "revision", "user_id"}))
+
+		gotSnippets, gotErr := testSnippetStore.Search(context.Background(), "Frog -pond*", database.Cursor{Limit: 10})
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if gotErr != nil {
+			t.Errorf("got error %v, want nil", gotErr)
+		}
+
+		assertSnippetList(t, gotSnippets, []*database.Snippet{})
+
+	})
+
+	t.Run("update snippet successfully", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("UPDATE snippets SET title = ?, content = ?, language = ?, expires = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), revision = revision + 1 WHERE expires > UTC_TIMESTAMP() AND id = ?")
+		revisionStmt := regexp.QuoteMeta("INSERT INTO snippet_revisions (snippet_id, revision, title, content, created) SELECT id, revision, title, content, UTC_TIMESTAMP() FROM snippets WHERE id = ?")
+
+		mock.ExpectBegin()
+		mock.ExpectExec(stmt).WithArgs("title", "content", "", 7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(revisionStmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		gotErr := testSnippetStore.Update(context.Background(), 1, "title", "content", "", 7)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if gotErr != nil {
+			t.Errorf("got error %v, want nil", gotErr)
+		}
+
+	})
+
+	t.Run("update snippet not found", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("UPDATE snippets SET title = ?, content = ?, language = ?, expires = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), revision = revision + 1 WHERE expires > UTC_TIMESTAMP() AND id = ?")
+
+		mock.ExpectBegin()
+		mock.ExpectExec(stmt).WithArgs("title", "content", "", 7, 10).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		gotErr := testSnippetStore.Update(context.Background(), 10, "title", "content", "", 7)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if !errors.Is(gotErr, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", gotErr, database.ErrNoRecord)
+		}
+
+	})
+
+	t.Run("delete snippet successfully", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("DELETE FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+
+		mock.ExpectExec(stmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		gotErr := testSnippetStore.Delete(context.Background(), 1)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if gotErr != nil {
+			t.Errorf("got error %v, want nil", gotErr)
+		}
+
+	})
+
+	t.Run("delete snippet not found", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("DELETE FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?")
+
+		mock.ExpectExec(stmt).WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		gotErr := testSnippetStore.Delete(context.Background(), 10)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if !errors.Is(gotErr, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", gotErr, database.ErrNoRecord)
+		}
+
+	})
+
+	t.Run("delete expired snippets in a batch", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		stmt := regexp.QuoteMeta("DELETE FROM snippets WHERE expires <= ? ORDER BY id LIMIT ?")
+
+		mock.ExpectExec(stmt).WithArgs(before, 100).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		got, gotErr := testSnippetStore.DeleteExpired(context.Background(), before, 100)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if gotErr != nil {
+			t.Errorf("got error %v, want nil", gotErr)
+		}
+
+		if got != 3 {
+			t.Errorf("got %d snippets deleted, want 3", got)
+		}
+
+	})
+
+	t.Run("count live snippets", func(t *testing.T) {
+		db, mock := setDbMock(t)
+		defer db.Close()
+		testSnippetStore := database.SnippetModel{DB: db}
+
+		stmt := regexp.QuoteMeta("SELECT COUNT(*) FROM snippets WHERE expires > UTC_TIMESTAMP()")
+
+		mock.ExpectQuery(stmt).WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(4))
+
+		got, gotErr := testSnippetStore.Count(context.Background())
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("expected sql statement not met, %v", err)
+		}
+
+		if gotErr != nil {
+			t.Errorf("got error %v, want nil", gotErr)
+		}
+
+		if got != 4 {
+			t.Errorf("got %d snippets, want 4", got)
+		}
+
+	})
+
 }
 
 func setDbMock(t testing.TB) (*sql.DB, sqlmock.Sqlmock) {
@@ -233,7 +487,7 @@ func setDbMock(t testing.TB) (*sql.DB, sqlmock.Sqlmock) {
 
 func assertSnippet(t testing.TB, got, want *database.Snippet) {
 	t.Helper()
-	if got.ID != want.ID || got.Content != want.Content || got.Title != want.Title || got.Created != want.Created || got.Expires != want.Expires {
+	if got.ID != want.ID || got.Content != want.Content || got.Title != want.Title || got.Language != want.Language || got.Created != want.Created || got.Expires != want.Expires || got.Revision != want.Revision {
 		t.Errorf("got snippet %v, want %v", got, want)
 	}
 }
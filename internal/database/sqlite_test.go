@@ -0,0 +1,79 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/database/storetest"
+	"github.com/andremfp/snippetbox/internal/migrations"
+)
+
+func TestSQLiteSnippetModel(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return &database.SnippetModel{Dialect: database.DialectSQLite, DB: setSQLiteDB(t)}
+	})
+}
+
+func TestSQLiteUserModel(t *testing.T) {
+	storetest.RunUsers(t, func(t *testing.T) database.UserStore {
+		return &database.UserModel{Dialect: database.DialectSQLite, DB: setSQLiteDB(t)}
+	})
+
+	t.Run("snippets record their author", func(t *testing.T) {
+		db := setSQLiteDB(t)
+		users := &database.UserModel{Dialect: database.DialectSQLite, DB: db}
+		snippets := &database.SnippetModel{Dialect: database.DialectSQLite, DB: db}
+
+		userID, err := users.Insert(context.Background(), "Alice", "alice@example.com", "pa55word")
+		if err != nil {
+			t.Fatalf("could not insert user, %v", err)
+		}
+
+		id, err := snippets.Insert(context.Background(), "title", "content", "", 1, userID)
+		if err != nil {
+			t.Fatalf("could not insert snippet, %v", err)
+		}
+
+		snippet, err := snippets.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet, %v", err)
+		}
+
+		if snippet.UserID != userID {
+			t.Errorf("got author %d, want %d", snippet.UserID, userID)
+		}
+
+		if _, err := snippets.Insert(context.Background(), "title", "content", "", 1, userID+1); err == nil {
+			t.Error("got no error inserting a snippet by an unknown author, want a foreign key error")
+		}
+	})
+}
+
+func TestSQLiteTokenModel(t *testing.T) {
+	storetest.RunTokens(t, func(t *testing.T) (database.UserStore, database.TokenStore) {
+		db := setSQLiteDB(t)
+		return &database.UserModel{Dialect: database.DialectSQLite, DB: db}, &database.TokenModel{Dialect: database.DialectSQLite, DB: db}
+	})
+}
+
+func setSQLiteDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := database.OpenDB(database.DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("could not open sqlite db, %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("could not load migrations, %v", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("could not migrate sqlite db, %v", err)
+	}
+
+	return db
+}
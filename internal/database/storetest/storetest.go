@@ -0,0 +1,655 @@
+// Package storetest is a conformance suite for database.Store,
+// database.UserStore and database.TokenStore implementations. Every backend
+// runs the same checks so they all behave the way the handlers expect,
+// whatever the SQL underneath looks like.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+// Factory returns an empty Store. It is called once per subtest, and any
+// cleanup should be registered on the given t.
+type Factory func(t *testing.T) database.Store
+
+func Run(t *testing.T, newStore Factory) {
+	t.Run("insert returns increasing ids", func(t *testing.T) {
+		store := newStore(t)
+
+		lastID := 0
+		for i := 0; i < 3; i++ {
+			id := mustInsert(t, store, "title", "content", 1)
+
+			if id <= lastID {
+				t.Errorf("got id %d after id %d, want a higher id", id, lastID)
+			}
+			lastID = id
+		}
+	})
+
+	t.Run("get returns the inserted snippet", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 7)
+
+		snippet, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if snippet.ID != id || snippet.Title != "title" || snippet.Content != "content" {
+			t.Errorf("got snippet %+v, want id %d with title and content", snippet, id)
+		}
+
+		if lifetime := snippet.Expires.Sub(snippet.Created); lifetime != 7*24*time.Hour {
+			t.Errorf("got lifetime %v, want %v", lifetime, 7*24*time.Hour)
+		}
+
+		if age := time.Since(snippet.Created); age < -time.Minute || age > time.Minute {
+			t.Errorf("got created %v, want around now", snippet.Created)
+		}
+	})
+
+	t.Run("get missing snippet returns ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		_, err := store.Get(context.Background(), id+1000)
+		if !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("get expired snippet returns ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", -1)
+
+		_, err := store.Get(context.Background(), id)
+		if !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("latest on an empty store returns no snippets", func(t *testing.T) {
+		store := newStore(t)
+
+		snippets, err := store.Latest(context.Background(), database.Cursor{Limit: 10})
+		if err != nil {
+			t.Fatalf("could not get latest snippets, %v", err)
+		}
+
+		if len(snippets) != 0 {
+			t.Errorf("got %d snippets, want 0", len(snippets))
+		}
+	})
+
+	t.Run("latest returns the 10 newest snippets, newest first", func(t *testing.T) {
+		store := newStore(t)
+
+		ids := []int{}
+		for i := 0; i < 12; i++ {
+			ids = append(ids, mustInsert(t, store, "title", "content", 1))
+		}
+
+		snippets, err := store.Latest(context.Background(), database.Cursor{Limit: 10})
+		if err != nil {
+			t.Fatalf("could not get latest snippets, %v", err)
+		}
+
+		if len(snippets) != 10 {
+			t.Fatalf("got %d snippets, want 10", len(snippets))
+		}
+
+		for i, snippet := range snippets {
+			if want := ids[len(ids)-1-i]; snippet.ID != want {
+				t.Errorf("got snippet id %d at position %d, want %d", snippet.ID, i, want)
+			}
+		}
+	})
+
+	t.Run("latest skips expired snippets", func(t *testing.T) {
+		store := newStore(t)
+
+		live := mustInsert(t, store, "live", "content", 1)
+		mustInsert(t, store, "expired", "content", -1)
+
+		snippets, err := store.Latest(context.Background(), database.Cursor{Limit: 10})
+		if err != nil {
+			t.Fatalf("could not get latest snippets, %v", err)
+		}
+
+		if len(snippets) != 1 || snippets[0].ID != live {
+			t.Errorf("got snippets %+v, want only snippet %d", snippets, live)
+		}
+	})
+
+	t.Run("latest pages back and forth by id", func(t *testing.T) {
+		store := newStore(t)
+
+		ids := []int{}
+		for i := 0; i < 7; i++ {
+			ids = append(ids, mustInsert(t, store, "title", "content", 1))
+		}
+		mustInsert(t, store, "expired", "content", -1)
+
+		first := mustLatest(t, store, database.Cursor{Limit: 3})
+		assertIDs(t, first, ids[6], ids[5], ids[4])
+
+		second := mustLatest(t, store, database.Cursor{Before: first[2].ID, Limit: 3})
+		assertIDs(t, second, ids[3], ids[2], ids[1])
+
+		last := mustLatest(t, store, database.Cursor{Before: second[2].ID, Limit: 3})
+		assertIDs(t, last, ids[0])
+
+		back := mustLatest(t, store, database.Cursor{After: last[0].ID, Limit: 3})
+		assertIDs(t, back, ids[3], ids[2], ids[1])
+
+		// Deleting a snippet never shifts the others between pages.
+		if err := store.Delete(context.Background(), ids[2]); err != nil {
+			t.Fatalf("could not delete snippet, %v", err)
+		}
+
+		second = mustLatest(t, store, database.Cursor{Before: first[2].ID, Limit: 3})
+		assertIDs(t, second, ids[3], ids[1], ids[0])
+	})
+
+	t.Run("search matches words in the title or content", func(t *testing.T) {
+		store := newStore(t)
+
+		haiku := mustInsert(t, store, "An old silent pond", "A frog jumps into the pond,\nsplash! Silence again.", 1)
+		recipe := mustInsert(t, store, "Pancakes", "Whisk flour, eggs and milk.", 1)
+		mustInsert(t, store, "Shopping list", "Bread, butter.", 1)
+
+		tests := []struct {
+			query string
+			want  []int
+		}{
+			{query: "pond", want: []int{haiku}},
+			{query: "FROG", want: []int{haiku}},
+			{query: "pancake", want: []int{recipe}},
+			{query: "whisk eggs", want: []int{recipe}},
+			{query: "frog eggs", want: []int{}},
+			{query: "flour, milk!", want: []int{recipe}},
+			{query: "the pond", want: []int{haiku}},
+			{query: "an", want: []int{recipe, haiku}},
+			{query: "spaceship", want: []int{}},
+			{query: "", want: []int{}},
+			{query: `"*+-()`, want: []int{}},
+		}
+
+		for _, tt := range tests {
+			snippets, err := store.Search(context.Background(), tt.query, database.Cursor{Limit: 10})
+			if err != nil {
+				t.Fatalf("could not search for %q, %v", tt.query, err)
+			}
+
+			assertIDs(t, snippets, tt.want...)
+		}
+	})
+
+	t.Run("search skips expired snippets and follows edits", func(t *testing.T) {
+		store := newStore(t)
+
+		mustInsert(t, store, "expired lighthouse", "content", -1)
+		edited := mustInsert(t, store, "lighthouse", "content", 1)
+		deleted := mustInsert(t, store, "lighthouse keeper", "content", 1)
+
+		if err := store.Delete(context.Background(), deleted); err != nil {
+			t.Fatalf("could not delete snippet, %v", err)
+		}
+
+		assertIDs(t, mustSearch(t, store, "lighthouse", database.Cursor{Limit: 10}), edited)
+
+		mustUpdate(t, store, edited, "windmill", "content")
+
+		assertIDs(t, mustSearch(t, store, "lighthouse", database.Cursor{Limit: 10}))
+		assertIDs(t, mustSearch(t, store, "windmill", database.Cursor{Limit: 10}), edited)
+	})
+
+	t.Run("search pages by id like latest", func(t *testing.T) {
+		store := newStore(t)
+
+		ids := []int{}
+		for i := 0; i < 5; i++ {
+			ids = append(ids, mustInsert(t, store, "match", "content", 1))
+			mustInsert(t, store, "other", "content", 1)
+		}
+
+		first := mustSearch(t, store, "match", database.Cursor{Limit: 2})
+		assertIDs(t, first, ids[4], ids[3])
+
+		second := mustSearch(t, store, "match", database.Cursor{Before: first[1].ID, Limit: 2})
+		assertIDs(t, second, ids[2], ids[1])
+
+		back := mustSearch(t, store, "match", database.Cursor{After: second[0].ID, Limit: 2})
+		assertIDs(t, back, ids[4], ids[3])
+	})
+
+	t.Run("utf-8 text round-trips unchanged", func(t *testing.T) {
+		store := newStore(t)
+
+		title := "Olá, 世界 🐌"
+		content := "Ünïcödé\n\tlinhas — “aspas” 日本語テキスト 🚀\n"
+
+		id := mustInsert(t, store, title, content, 1)
+
+		snippet, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if snippet.Title != title || snippet.Content != content {
+			t.Errorf("got title %q content %q, want title %q content %q", snippet.Title, snippet.Content, title, content)
+		}
+	})
+
+	t.Run("update replaces title, content and expiry", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		before, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if err := store.Update(context.Background(), id, "new title", "new content", "", 7); err != nil {
+			t.Fatalf("could not update snippet %d, %v", id, err)
+		}
+
+		after, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if after.ID != id || after.Title != "new title" || after.Content != "new content" {
+			t.Errorf("got snippet %+v, want id %d with new title and content", after, id)
+		}
+
+		if !after.Created.Equal(before.Created) {
+			t.Errorf("got created %v, want it unchanged at %v", after.Created, before.Created)
+		}
+
+		if !after.Expires.After(before.Expires) {
+			t.Errorf("got expires %v, want it later than %v", after.Expires, before.Expires)
+		}
+	})
+
+	t.Run("language is saved and follows the snippet across revisions", func(t *testing.T) {
+		store := newStore(t)
+
+		id, err := store.Insert(context.Background(), "title", "content", "go", 1, 0)
+		if err != nil {
+			t.Fatalf("could not insert snippet, %v", err)
+		}
+
+		if err := store.Update(context.Background(), id, "title", "new content", "python", 1); err != nil {
+			t.Fatalf("could not update snippet %d, %v", id, err)
+		}
+
+		snippet, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		old, err := store.GetRevision(context.Background(), id, 1)
+		if err != nil {
+			t.Fatalf("could not get revision 1 of snippet %d, %v", id, err)
+		}
+
+		for _, got := range []*database.Snippet{snippet, old} {
+			if got.Language != "python" {
+				t.Errorf("got language %q at revision %d, want %q", got.Language, got.Revision, "python")
+			}
+		}
+
+		if latest := mustLatest(t, store, database.Cursor{Limit: 1}); len(latest) != 1 || latest[0].Language != "python" {
+			t.Errorf("got latest %+v, want the snippet in python", latest)
+		}
+	})
+
+	t.Run("update with unchanged values succeeds", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		for i := 0; i < 2; i++ {
+			if err := store.Update(context.Background(), id, "title", "content", "", 1); err != nil {
+				t.Errorf("got error %v on update %d, want nil", err, i+1)
+			}
+		}
+	})
+
+	t.Run("update missing or expired snippet returns ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", -1)
+
+		for _, id := range []int{id, id + 1000} {
+			err := store.Update(context.Background(), id, "title", "content", "", 1)
+			if !errors.Is(err, database.ErrNoRecord) {
+				t.Errorf("got error %v updating snippet %d, want %v", err, id, database.ErrNoRecord)
+			}
+		}
+	})
+
+	t.Run("delete removes the snippet", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+		kept := mustInsert(t, store, "title", "content", 1)
+
+		if err := store.Delete(context.Background(), id); err != nil {
+			t.Fatalf("could not delete snippet %d, %v", id, err)
+		}
+
+		if _, err := store.Get(context.Background(), id); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", err, database.ErrNoRecord)
+		}
+
+		if _, err := store.Get(context.Background(), kept); err != nil {
+			t.Errorf("got error %v getting snippet %d, want nil", err, kept)
+		}
+
+		if err := store.Delete(context.Background(), id); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v deleting snippet twice, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("delete expired snippet returns ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", -1)
+
+		if err := store.Delete(context.Background(), id); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("ids are not reused after delete", func(t *testing.T) {
+		store := newStore(t)
+
+		mustInsert(t, store, "title", "content", 1)
+		id := mustInsert(t, store, "title", "content", 1)
+
+		if err := store.Delete(context.Background(), id); err != nil {
+			t.Fatalf("could not delete snippet %d, %v", id, err)
+		}
+
+		if next := mustInsert(t, store, "title", "content", 1); next <= id {
+			t.Errorf("got id %d after deleting %d, want a higher id", next, id)
+		}
+	})
+
+	t.Run("new snippet starts at revision 1", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		snippet, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if snippet.Revision != 1 {
+			t.Errorf("got revision %d, want 1", snippet.Revision)
+		}
+
+		revisions, err := store.Revisions(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get revisions of snippet %d, %v", id, err)
+		}
+
+		if len(revisions) != 1 || revisions[0].Revision != 1 || revisions[0].Title != "title" || revisions[0].Content != "content" {
+			t.Errorf("got revisions %+v, want only revision 1 with title and content", revisions)
+		}
+	})
+
+	t.Run("update keeps every prior revision", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "v1", "content 1", 1)
+		mustUpdate(t, store, id, "v2", "content 2")
+		mustUpdate(t, store, id, "v3", "content 3")
+
+		snippet, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get snippet %d, %v", id, err)
+		}
+
+		if snippet.Revision != 3 || snippet.Title != "v3" {
+			t.Errorf("got revision %d titled %q, want revision 3 titled %q", snippet.Revision, snippet.Title, "v3")
+		}
+
+		revisions, err := store.Revisions(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get revisions of snippet %d, %v", id, err)
+		}
+
+		if len(revisions) != 3 {
+			t.Fatalf("got %d revisions, want 3", len(revisions))
+		}
+
+		for i, revision := range revisions {
+			want := 3 - i
+			if revision.SnippetID != id || revision.Revision != want || revision.Content != fmt.Sprintf("content %d", want) {
+				t.Errorf("got revision %+v at position %d, want revision %d of snippet %d", revision, i, want, id)
+			}
+		}
+
+		old, err := store.GetRevision(context.Background(), id, 1)
+		if err != nil {
+			t.Fatalf("could not get revision 1 of snippet %d, %v", id, err)
+		}
+
+		if old.ID != id || old.Revision != 1 || old.Title != "v1" || old.Content != "content 1" {
+			t.Errorf("got snippet %+v, want revision 1 of snippet %d", old, id)
+		}
+	})
+
+	t.Run("missing revisions return ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+		expired := mustInsert(t, store, "title", "content", -1)
+
+		if _, err := store.GetRevision(context.Background(), id, 2); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v for unknown revision, want %v", err, database.ErrNoRecord)
+		}
+
+		if _, err := store.GetRevision(context.Background(), expired, 1); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v for expired snippet, want %v", err, database.ErrNoRecord)
+		}
+
+		if _, err := store.Revisions(context.Background(), expired); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v listing revisions of expired snippet, want %v", err, database.ErrNoRecord)
+		}
+
+		if err := store.Delete(context.Background(), id); err != nil {
+			t.Fatalf("could not delete snippet %d, %v", id, err)
+		}
+
+		if _, err := store.Revisions(context.Background(), id); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v listing revisions of deleted snippet, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("delete expired removes only expired snippets", func(t *testing.T) {
+		store := newStore(t)
+
+		live := mustInsert(t, store, "live", "content", 1)
+		mustInsert(t, store, "expired", "content", -1)
+		mustInsert(t, store, "expired", "content", -2)
+
+		deleted, err := store.DeleteExpired(context.Background(), time.Now(), 10)
+		if err != nil {
+			t.Fatalf("could not delete expired snippets, %v", err)
+		}
+
+		if deleted != 2 {
+			t.Errorf("got %d snippets deleted, want 2", deleted)
+		}
+
+		if _, err := store.Get(context.Background(), live); err != nil {
+			t.Errorf("got error %v getting live snippet, want nil", err)
+		}
+
+		deleted, _ = store.DeleteExpired(context.Background(), time.Now(), 10)
+		if deleted != 0 {
+			t.Errorf("got %d snippets deleted on second run, want 0", deleted)
+		}
+	})
+
+	t.Run("delete expired honours the limit and the cutoff", func(t *testing.T) {
+		store := newStore(t)
+
+		for i := 0; i < 3; i++ {
+			mustInsert(t, store, "title", "content", 1)
+		}
+
+		deleted, _ := store.DeleteExpired(context.Background(), time.Now(), 10)
+		if deleted != 0 {
+			t.Errorf("got %d snippets deleted before they expire, want 0", deleted)
+		}
+
+		later := time.Now().Add(48 * time.Hour)
+
+		for _, want := range []int{2, 1, 0} {
+			deleted, err := store.DeleteExpired(context.Background(), later, 2)
+			if err != nil {
+				t.Fatalf("could not delete expired snippets, %v", err)
+			}
+
+			if deleted != want {
+				t.Errorf("got %d snippets deleted, want %d", deleted, want)
+			}
+		}
+	})
+
+	t.Run("count includes only live snippets", func(t *testing.T) {
+		store := newStore(t)
+
+		count, err := store.Count(context.Background())
+		if err != nil {
+			t.Fatalf("could not count snippets, %v", err)
+		}
+
+		if count != 0 {
+			t.Errorf("got %d snippets in an empty store, want 0", count)
+		}
+
+		mustInsert(t, store, "live", "content", 1)
+		deleted := mustInsert(t, store, "deleted", "content", 1)
+		mustInsert(t, store, "live", "content", 7)
+		mustInsert(t, store, "expired", "content", -1)
+
+		if err := store.Delete(context.Background(), deleted); err != nil {
+			t.Fatalf("could not delete snippet %d, %v", deleted, err)
+		}
+
+		count, err = store.Count(context.Background())
+		if err != nil {
+			t.Fatalf("could not count snippets, %v", err)
+		}
+
+		if count != 2 {
+			t.Errorf("got %d snippets, want 2", count)
+		}
+	})
+
+	t.Run("canceled context returns ErrCanceled", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := store.Insert(ctx, "title", "content", "", 1, 0); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got insert error %v, want %v", err, database.ErrCanceled)
+		}
+
+		if _, err := store.Get(ctx, id); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got get error %v, want %v", err, database.ErrCanceled)
+		}
+
+		if _, err := store.Latest(ctx, database.Cursor{Limit: 10}); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got latest error %v, want %v", err, database.ErrCanceled)
+		}
+
+		if _, err := store.Search(ctx, "title", database.Cursor{Limit: 10}); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got search error %v, want %v", err, database.ErrCanceled)
+		}
+	})
+
+	t.Run("expired deadline returns ErrTimeout", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsert(t, store, "title", "content", 1)
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		if _, err := store.Get(ctx, id); !errors.Is(err, database.ErrTimeout) {
+			t.Errorf("got get error %v, want %v", err, database.ErrTimeout)
+		}
+	})
+}
+
+func mustInsert(t *testing.T, store database.Store, title, content string, expires int) int {
+	t.Helper()
+	id, err := store.Insert(context.Background(), title, content, "", expires, 0)
+	if err != nil {
+		t.Fatalf("could not insert snippet, %v", err)
+	}
+
+	return id
+}
+
+func mustLatest(t *testing.T, store database.Store, cursor database.Cursor) []*database.Snippet {
+	t.Helper()
+	snippets, err := store.Latest(context.Background(), cursor)
+	if err != nil {
+		t.Fatalf("could not get latest snippets, %v", err)
+	}
+
+	return snippets
+}
+
+func mustSearch(t *testing.T, store database.Store, query string, cursor database.Cursor) []*database.Snippet {
+	t.Helper()
+	snippets, err := store.Search(context.Background(), query, cursor)
+	if err != nil {
+		t.Fatalf("could not search for %q, %v", query, err)
+	}
+
+	return snippets
+}
+
+func assertIDs(t *testing.T, snippets []*database.Snippet, want ...int) {
+	t.Helper()
+	got := []int{}
+	for _, snippet := range snippets {
+		got = append(got, snippet.ID)
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got snippet ids %v, want %v", got, want)
+	}
+}
+
+func mustUpdate(t *testing.T, store database.Store, id int, title, content string) {
+	t.Helper()
+	if err := store.Update(context.Background(), id, title, content, "", 1); err != nil {
+		t.Fatalf("could not update snippet %d, %v", id, err)
+	}
+}
@@ -0,0 +1,143 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+// TokenFactory returns an empty TokenStore and the UserStore its tokens
+// belong to, sharing one database.
+type TokenFactory func(t *testing.T) (database.UserStore, database.TokenStore)
+
+func RunTokens(t *testing.T, newStores TokenFactory) {
+	t.Run("insert returns a token that authenticates", func(t *testing.T) {
+		users, tokens := newStores(t)
+		userID := mustInsertUser(t, users, "Alice", "alice@example.com", "pa55word")
+
+		plaintext := mustInsertToken(t, tokens, userID, "deploy", []string{database.ScopeRead, database.ScopeWrite}, time.Time{})
+
+		if !strings.HasPrefix(plaintext, "sbx_") {
+			t.Errorf("got token %q, want the sbx_ prefix", plaintext)
+		}
+
+		token, err := tokens.Authenticate(context.Background(), plaintext)
+		if err != nil {
+			t.Fatalf("could not authenticate token, %v", err)
+		}
+
+		if token.UserID != userID || token.Name != "deploy" || !slices.Equal(token.Scopes, []string{"read", "write"}) || !token.Expires.IsZero() {
+			t.Errorf("got token %+v, want user %d, deploy, read and write, no expiry", token, userID)
+		}
+
+		if !token.HasScope(database.ScopeWrite) || token.HasScope("admin") {
+			t.Errorf("got scopes %v, want write and not admin", token.Scopes)
+		}
+	})
+
+	t.Run("authenticate records when the token was last used", func(t *testing.T) {
+		users, tokens := newStores(t)
+		userID := mustInsertUser(t, users, "Alice", "alice@example.com", "pa55word")
+		plaintext := mustInsertToken(t, tokens, userID, "deploy", []string{database.ScopeRead}, time.Time{})
+
+		first, err := tokens.Authenticate(context.Background(), plaintext)
+		if err != nil {
+			t.Fatalf("could not authenticate token, %v", err)
+		}
+
+		if !first.LastUsed.IsZero() {
+			t.Errorf("got last used %v on first use, want zero", first.LastUsed)
+		}
+
+		listed, err := tokens.ForUser(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("could not list tokens, %v", err)
+		}
+
+		if len(listed) != 1 || time.Since(listed[0].LastUsed) > time.Minute {
+			t.Errorf("got tokens %+v, want one used just now", listed)
+		}
+	})
+
+	t.Run("unknown, expired and revoked tokens are invalid", func(t *testing.T) {
+		users, tokens := newStores(t)
+		userID := mustInsertUser(t, users, "Alice", "alice@example.com", "pa55word")
+
+		expired := mustInsertToken(t, tokens, userID, "old", []string{database.ScopeRead}, time.Now().Add(-time.Hour))
+		live := mustInsertToken(t, tokens, userID, "live", []string{database.ScopeRead}, time.Now().Add(time.Hour))
+		revoked := mustInsertToken(t, tokens, userID, "revoked", []string{database.ScopeRead}, time.Time{})
+
+		listed, err := tokens.ForUser(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("could not list tokens, %v", err)
+		}
+
+		if err := tokens.Delete(context.Background(), userID, listed[0].ID); err != nil {
+			t.Fatalf("could not revoke token, %v", err)
+		}
+
+		if _, err := tokens.Authenticate(context.Background(), live); err != nil {
+			t.Errorf("got error %v for a live token, want none", err)
+		}
+
+		for _, plaintext := range []string{"sbx_unknown", expired, revoked} {
+			if _, err := tokens.Authenticate(context.Background(), plaintext); !errors.Is(err, database.ErrInvalidToken) {
+				t.Errorf("got error %v, want %v", err, database.ErrInvalidToken)
+			}
+		}
+	})
+
+	t.Run("users only see and revoke their own tokens", func(t *testing.T) {
+		users, tokens := newStores(t)
+		alice := mustInsertUser(t, users, "Alice", "alice@example.com", "pa55word")
+		bob := mustInsertUser(t, users, "Bob", "bob@example.com", "pa55word")
+
+		mustInsertToken(t, tokens, alice, "first", []string{database.ScopeRead}, time.Time{})
+		mustInsertToken(t, tokens, bob, "bob's", []string{database.ScopeRead}, time.Time{})
+		mustInsertToken(t, tokens, alice, "second", []string{database.ScopeRead}, time.Time{})
+
+		listed, err := tokens.ForUser(context.Background(), alice)
+		if err != nil {
+			t.Fatalf("could not list tokens, %v", err)
+		}
+
+		names := []string{}
+		for _, token := range listed {
+			names = append(names, token.Name)
+		}
+
+		if !slices.Equal(names, []string{"second", "first"}) {
+			t.Errorf("got tokens %v, want second and first", names)
+		}
+
+		if err := tokens.Delete(context.Background(), bob, listed[0].ID); !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v revoking another user's token, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("canceled context returns ErrCanceled", func(t *testing.T) {
+		_, tokens := newStores(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := tokens.Authenticate(ctx, "sbx_unknown"); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got authenticate error %v, want %v", err, database.ErrCanceled)
+		}
+	})
+}
+
+func mustInsertToken(t *testing.T, store database.TokenStore, userID int, name string, scopes []string, expires time.Time) string {
+	t.Helper()
+	plaintext, err := store.Insert(context.Background(), userID, name, scopes, expires)
+	if err != nil {
+		t.Fatalf("could not insert token, %v", err)
+	}
+
+	return plaintext
+}
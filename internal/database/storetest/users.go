@@ -0,0 +1,105 @@
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+// UserFactory returns an empty UserStore, like Factory.
+type UserFactory func(t *testing.T) database.UserStore
+
+func RunUsers(t *testing.T, newStore UserFactory) {
+	t.Run("insert stores a hashed password", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsertUser(t, store, "Alice", "alice@example.com", "pa55word")
+
+		user, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get user, %v", err)
+		}
+
+		if user.ID != id || user.Name != "Alice" || user.Email != "alice@example.com" {
+			t.Errorf("got user %+v, want id %d, Alice and alice@example.com", user, id)
+		}
+
+		if len(user.HashedPassword) == 0 || bytes.Contains(user.HashedPassword, []byte("pa55word")) {
+			t.Errorf("got hashed password %q, want a bcrypt hash", user.HashedPassword)
+		}
+	})
+
+	t.Run("insert rejects a duplicate email whatever its case", func(t *testing.T) {
+		store := newStore(t)
+
+		mustInsertUser(t, store, "Alice", "alice@example.com", "pa55word")
+
+		_, err := store.Insert(context.Background(), "Impostor", "ALICE@example.com", "pa55word")
+		if !errors.Is(err, database.ErrDuplicateEmail) {
+			t.Errorf("got error %v, want %v", err, database.ErrDuplicateEmail)
+		}
+	})
+
+	t.Run("authenticate checks the email and password", func(t *testing.T) {
+		store := newStore(t)
+
+		id := mustInsertUser(t, store, "Alice", "alice@example.com", "pa55word")
+
+		tests := []struct {
+			email    string
+			password string
+			wantID   int
+			wantErr  error
+		}{
+			{email: "alice@example.com", password: "pa55word", wantID: id},
+			{email: "Alice@Example.com", password: "pa55word", wantID: id},
+			{email: "alice@example.com", password: "wrong", wantErr: database.ErrInvalidCredentials},
+			{email: "bob@example.com", password: "pa55word", wantErr: database.ErrInvalidCredentials},
+		}
+
+		for _, tt := range tests {
+			gotID, err := store.Authenticate(context.Background(), tt.email, tt.password)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v for %s, want %v", err, tt.email, tt.wantErr)
+			}
+
+			if gotID != tt.wantID {
+				t.Errorf("got id %d for %s, want %d", gotID, tt.email, tt.wantID)
+			}
+		}
+	})
+
+	t.Run("missing user returns ErrNoRecord", func(t *testing.T) {
+		store := newStore(t)
+
+		_, err := store.Get(context.Background(), 1000)
+		if !errors.Is(err, database.ErrNoRecord) {
+			t.Errorf("got error %v, want %v", err, database.ErrNoRecord)
+		}
+	})
+
+	t.Run("canceled context returns ErrCanceled", func(t *testing.T) {
+		store := newStore(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := store.Get(ctx, 1); !errors.Is(err, database.ErrCanceled) {
+			t.Errorf("got get error %v, want %v", err, database.ErrCanceled)
+		}
+	})
+}
+
+func mustInsertUser(t *testing.T, store database.UserStore, name, email, password string) int {
+	t.Helper()
+	id, err := store.Insert(context.Background(), name, email, password)
+	if err != nil {
+		t.Fatalf("could not insert user, %v", err)
+	}
+
+	return id
+}
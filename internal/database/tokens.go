@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes an API token can be granted.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// tokenPrefix starts every API token, so a leaked one is easy to recognise.
+const tokenPrefix = "sbx_"
+
+// TokenStore is the API token persistence used by the handlers. Only a hash
+// of each token is kept, so the plaintext Insert returns cannot be recovered
+// later. An unknown or expired token is reported as ErrInvalidToken.
+type TokenStore interface {
+	Insert(ctx context.Context, userID int, name string, scopes []string, expires time.Time) (string, error)
+	Authenticate(ctx context.Context, plaintext string) (*Token, error)
+	ForUser(ctx context.Context, userID int) ([]*Token, error)
+	Delete(ctx context.Context, userID int, id int) error
+}
+
+// Token is an API token minus its secret. A zero Expires means it never
+// expires, and a zero LastUsed that it has not been used yet.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	Expires  time.Time
+	LastUsed time.Time
+}
+
+func (t *Token) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// Expired reports whether the token has an expiry that has passed by now.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// TokenModel is the TokenStore backed by a SQL database.
+type TokenModel struct {
+	DB *sql.DB
+	// Dialect is the SQL the database speaks, MySQL if nil.
+	Dialect      *Dialect
+	QueryTimeout time.Duration
+}
+
+// Insert creates a token for the user and returns its plaintext. A zero
+// expires makes a token that never expires.
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string, scopes []string, expires time.Time) (string, error) {
+	plaintext, hash, err := newTokenSecret()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `INSERT INTO api_tokens (user_id, name, hash, scopes, created, expires) VALUES(?, ?, ?, ?, ` + d.now + `, ?)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, userID, name, hash, strings.Join(scopes, " "), nullTime(expires, d.time))
+	if err != nil {
+		return "", contextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Authenticate returns the live token with the given plaintext and records
+// that it was used. LastUsed on the returned token is the use before this one.
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (*Token, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `SELECT id, user_id, name, scopes, created, expires, last_used FROM api_tokens
+			WHERE hash = ? AND (expires IS NULL OR expires > ` + d.now + `)`
+
+	token, err := scanToken(m.DB.QueryRowContext(ctx, stmt, hashToken(plaintext)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, contextError(ctx, err)
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used = `+d.now+` WHERE id = ?`, token.ID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return token, nil
+}
+
+// ForUser returns every token of the user, expired ones included, newest
+// first.
+func (m *TokenModel) ForUser(ctx context.Context, userID int) ([]*Token, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	stmt := `SELECT id, user_id, name, scopes, created, expires, last_used FROM api_tokens
+			WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	tokens := []*Token{}
+
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes one of the user's tokens.
+func (m *TokenModel) Delete(ctx context.Context, userID int, id int) error {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM api_tokens WHERE user_id = ? AND id = ?`
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// newTokenSecret returns a new token and the hash to store for it. The token
+// is 256 random bits, so a single unsalted SHA-256 is as good as bcrypt here
+// and cheap enough to run on every API request.
+func newTokenSecret() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	plaintext := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return plaintext, hashToken(plaintext), nil
+}
+
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// nullTime stores the zero time as NULL, and any other time through format.
+func nullTime(t time.Time, format func(time.Time) any) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return format(t)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row rowScanner) (*Token, error) {
+	token := &Token{}
+
+	var scopes string
+	var expires, lastUsed sql.NullTime
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.Created, &expires, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.Expires = expires.Time
+	token.LastUsed = lastUsed.Time
+
+	return token, nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt work factor for new password hashes.
+const passwordCost = 12
+
+// UserStore is the user account persistence used by the handlers. Emails are
+// unique regardless of case, and a wrong email or password is reported as
+// ErrInvalidCredentials without saying which.
+type UserStore interface {
+	Insert(ctx context.Context, name string, email string, password string) (int, error)
+	Authenticate(ctx context.Context, email string, password string) (int, error)
+	Get(ctx context.Context, id int) (*User, error)
+}
+
+type User struct {
+	ID             int
+	Name           string
+	Email          string
+	HashedPassword []byte
+	Created        time.Time
+}
+
+// UserModel is the UserStore backed by a SQL database.
+type UserModel struct {
+	DB *sql.DB
+	// Dialect is the SQL the database speaks, MySQL if nil.
+	Dialect      *Dialect
+	QueryTimeout time.Duration
+}
+
+func (m *UserModel) Insert(ctx context.Context, name string, email string, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	d := dialectOr(m.Dialect)
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, ` + d.now + `)`
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		if d.duplicateEmail(err) {
+			return 0, ErrDuplicateEmail
+		}
+
+		return 0, contextError(ctx, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Authenticate returns the id of the user with the given email and password.
+func (m *UserModel) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
+
+	row := m.DB.QueryRowContext(ctx, stmt, email)
+
+	var id int
+	var hashedPassword []byte
+
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		} else {
+			return 0, contextError(ctx, err)
+		}
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		} else {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+func (m *UserModel) Get(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := queryContext(ctx, m.QueryTimeout)
+	defer cancel()
+
+	stmt := `SELECT id, name, email, hashed_password, created FROM users WHERE id = ?`
+
+	row := m.DB.QueryRowContext(ctx, stmt, id)
+
+	user := &User{}
+
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.HashedPassword, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,255 @@
+// Package diff computes line-based unified diffs between two texts.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxEdits bounds the edit scripts Unified looks for. The search takes
+// memory in the square of the edits, so two unrelated revisions of a long
+// snippet could otherwise take gigabytes.
+const MaxEdits = 1000
+
+var ErrTooLarge = errors.New("diff: too many changes to show")
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	}
+
+	return "equal"
+}
+
+// Prefix returns the character a unified diff puts in front of the line.
+func (op Op) Prefix() string {
+	switch op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	}
+
+	return " "
+}
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is a run of changes together with the unchanged lines around them.
+// Line numbers are 1-based, as in the "@@ -1,3 +1,4 @@" header.
+type Hunk struct {
+	FromLine  int
+	FromCount int
+	ToLine    int
+	ToCount   int
+	Lines     []Line
+}
+
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", span(h.FromLine, h.FromCount), span(h.ToLine, h.ToCount))
+}
+
+// Unified diffs from against to line by line, keeping context unchanged
+// lines around every change. Changes closer together than twice the context
+// share a hunk. Identical texts give no hunks, and texts that need more than
+// MaxEdits line insertions and deletions give ErrTooLarge.
+func Unified(from, to string, context int) ([]Hunk, error) {
+	lines, ok := compare(splitLines(from), splitLines(to))
+	if !ok {
+		return nil, ErrTooLarge
+	}
+
+	// fromLine[i] and toLine[i] are the line numbers lines[i] starts at.
+	fromLine := make([]int, len(lines)+1)
+	toLine := make([]int, len(lines)+1)
+	fromLine[0], toLine[0] = 1, 1
+	for i, line := range lines {
+		fromLine[i+1], toLine[i+1] = fromLine[i], toLine[i]
+		if line.Op != Insert {
+			fromLine[i+1]++
+		}
+		if line.Op != Delete {
+			toLine[i+1]++
+		}
+	}
+
+	hunks := []Hunk{}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		last := i
+		for j := i + 1; j < len(lines) && j <= last+2*context+1; j++ {
+			if lines[j].Op != Equal {
+				last = j
+			}
+		}
+
+		start := max(i-context, 0)
+		stop := min(last+context+1, len(lines))
+
+		hunk := Hunk{FromLine: fromLine[start], ToLine: toLine[start]}
+		for _, line := range lines[start:stop] {
+			hunk.add(line)
+		}
+		hunks = append(hunks, hunk)
+
+		i = stop
+	}
+
+	return hunks, nil
+}
+
+// String renders hunks as the body of a unified diff.
+func String(hunks []Hunk) string {
+	var b strings.Builder
+
+	for _, hunk := range hunks {
+		b.WriteString(hunk.Header())
+		b.WriteByte('\n')
+
+		for _, line := range hunk.Lines {
+			b.WriteString(line.Op.Prefix())
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+func (h *Hunk) add(line Line) {
+	h.Lines = append(h.Lines, line)
+
+	if line.Op != Insert {
+		h.FromCount++
+	}
+	if line.Op != Delete {
+		h.ToCount++
+	}
+}
+
+// compare returns the shortest edit script turning a into b, using Myers'
+// O(ND) algorithm, or false if it takes more than MaxEdits edits.
+func compare(a, b []string) ([]Line, bool) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] is the part of v that step d starts from and can reach,
+	// diagonals -d-1 to d+1, so the trace grows with D² rather than D·(N+M).
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		if d > MaxEdits {
+			return nil, false
+		}
+
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func backtrack(a, b []string, trace [][]int) []Line {
+	x, y := len(a), len(b)
+	lines := []Line{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		// v(k) reads diagonal k from the window, which starts at -d-1.
+		window := trace[d]
+		v := func(k int) int { return window[k+d+1] }
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			lines = append(lines, Line{Op: Equal, Text: a[x]})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, Line{Op: Insert, Text: b[prevY]})
+			} else {
+				lines = append(lines, Line{Op: Delete, Text: a[prevX]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+}
+
+func span(line, count int) string {
+	// An empty range points at the line before it, as diff(1) does.
+	if count == 0 {
+		line--
+	}
+
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+
+	return fmt.Sprintf("%d,%d", line, count)
+}
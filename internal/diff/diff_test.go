@@ -0,0 +1,124 @@
+package diff_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/diff"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		context int
+		want    string
+	}{
+		{
+			name: "identical texts have no hunks",
+			from: "a\nb\nc\n",
+			to:   "a\nb\nc\n",
+			want: "",
+		},
+		{
+			name: "changed line in the middle",
+			from: "a\nb\nc\n",
+			to:   "a\nB\nc\n",
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "line added at the start",
+			from: "b\nc\n",
+			to:   "a\nb\nc\n",
+			want: "@@ -1,2 +1,3 @@\n+a\n b\n c\n",
+		},
+		{
+			name: "line removed at the end",
+			from: "a\nb\nc\n",
+			to:   "a\nb\n",
+			want: "@@ -1,3 +1,2 @@\n a\n b\n-c\n",
+		},
+		{
+			name: "everything new",
+			from: "",
+			to:   "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "windows line endings are ignored",
+			from: "a\r\nb\r\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "distant changes get separate hunks",
+			from:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:      "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			context: 2,
+			want:    "@@ -1,3 +1,3 @@\n-1\n+one\n 2\n 3\n@@ -8,3 +8,3 @@\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			from: "1\n2\n3\n4\n5\n",
+			to:   "one\n2\n3\n4\nfive\n",
+			want: "@@ -1,5 +1,5 @@\n-1\n+one\n 2\n 3\n 4\n-5\n+five\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := tt.context
+			if context == 0 {
+				context = 3
+			}
+
+			hunks, err := diff.Unified(tt.from, tt.to, context)
+			if err != nil {
+				t.Fatalf("could not diff, %v", err)
+			}
+
+			if got := diff.String(hunks); got != tt.want {
+				t.Errorf("got diff\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedLargeRevisions(t *testing.T) {
+	var a, b, edited strings.Builder
+	for i := range 6000 {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+		if i%100 == 0 {
+			fmt.Fprintf(&edited, "edited%d\n", i)
+		} else {
+			fmt.Fprintf(&edited, "a%d\n", i)
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err := diff.Unified(a.String(), b.String(), 3); !errors.Is(err, diff.ErrTooLarge) {
+		t.Errorf("got error %v for unrelated revisions, want %v", err, diff.ErrTooLarge)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("got %d MB allocated for unrelated revisions, want at most 64 MB", allocated>>20)
+	}
+
+	hunks, err := diff.Unified(a.String(), edited.String(), 3)
+	if err != nil {
+		t.Fatalf("could not diff a long snippet with few changes, %v", err)
+	}
+
+	if len(hunks) != 60 {
+		t.Errorf("got %d hunks, want one per edited line", len(hunks))
+	}
+}
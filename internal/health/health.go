@@ -0,0 +1,149 @@
+// Package health answers the liveness and readiness probes of an
+// orchestrator.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrShuttingDown fails readiness once graceful shutdown has begun.
+var ErrShuttingDown = errors.New("health: shutting down")
+
+// Check is one thing the instance needs before it can take traffic. Run
+// should return once ctx is done, but a check that cannot is abandoned at
+// the deadline and reported as failed.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Checker serves the probes: Live answers as long as the process can, and
+// Ready runs every check within Timeout.
+type Checker struct {
+	Checks  []Check
+	Timeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+// Report is the body of both probes.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+const (
+	statusOK      = "ok"
+	statusFailing = "failing"
+)
+
+// ShutDown makes readiness fail from now on, so no new traffic is sent
+// while in-flight requests drain.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: statusOK})
+}
+
+// Ready runs the checks concurrently and answers 503 if any fails.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeReport(w, status, report)
+}
+
+// Run runs the checks concurrently, giving up on any still running after
+// Timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: statusOK, Checks: map[string]CheckResult{}}
+
+	if c.shuttingDown.Load() {
+		report.Status = statusFailing
+		report.Checks["shutdown"] = CheckResult{Status: statusFailing, Error: ErrShuttingDown.Error()}
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range c.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result := run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[check.Name] = result
+			if result.Status != statusOK {
+				report.Status = statusFailing
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+// run runs check, waiting no longer than ctx allows.
+func run(ctx context.Context, check Check) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: statusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = statusFailing
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	body, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,108 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/health"
+)
+
+func TestChecker(t *testing.T) {
+	ok := health.Check{Name: "ok", Run: func(context.Context) error { return nil }}
+	broken := health.Check{Name: "broken", Run: func(context.Context) error { return errors.New("disk on fire") }}
+	// stuck ignores its context, so only the checker's deadline ends it.
+	stuck := health.Check{Name: "stuck", Run: func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	tests := []struct {
+		name         string
+		checks       []health.Check
+		shutDown     bool
+		wantStatus   int
+		wantFailing  []string
+		wantPassing  []string
+		wantMaxDelay time.Duration
+	}{
+		{
+			name:        "every check passes",
+			checks:      []health.Check{ok},
+			wantStatus:  http.StatusOK,
+			wantPassing: []string{"ok"},
+		},
+		{
+			name:        "a failing check fails readiness",
+			checks:      []health.Check{ok, broken},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantFailing: []string{"broken"},
+			wantPassing: []string{"ok"},
+		},
+		{
+			name:         "a stuck check is abandoned at the deadline",
+			checks:       []health.Check{ok, stuck},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantFailing:  []string{"stuck"},
+			wantPassing:  []string{"ok"},
+			wantMaxDelay: 500 * time.Millisecond,
+		},
+		{
+			name:        "shutting down fails readiness",
+			checks:      []health.Check{ok},
+			shutDown:    true,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantFailing: []string{"shutdown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &health.Checker{Checks: tt.checks, Timeout: 50 * time.Millisecond}
+			if tt.shutDown {
+				checker.ShutDown()
+			}
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			checker.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if tt.wantMaxDelay > 0 && time.Since(start) > tt.wantMaxDelay {
+				t.Errorf("took %v, want at most %v", time.Since(start), tt.wantMaxDelay)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var report health.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("could not decode report %q, %v", w.Body.String(), err)
+			}
+
+			for _, name := range tt.wantFailing {
+				if result := report.Checks[name]; result.Status != "failing" || result.Error == "" {
+					t.Errorf("got check %s %+v, want failing with an error", name, result)
+				}
+			}
+
+			for _, name := range tt.wantPassing {
+				if result := report.Checks[name]; result.Status != "ok" {
+					t.Errorf("got check %s %+v, want ok", name, result)
+				}
+			}
+
+			// Liveness does not depend on the checks or on shutting down.
+			w = httptest.NewRecorder()
+			checker.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if w.Code != http.StatusOK || w.Body.String() != "{\n\t\"status\": \"ok\"\n}\n" {
+				t.Errorf("got liveness %d %q, want 200 and ok", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Formats New accepts.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New returns a logger writing records at level or above to w, as logfmt
+// style text or as one JSON object per line.
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q, want %s or %s", format, FormatText, FormatJSON)
+	}
+}
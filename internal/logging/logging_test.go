@@ -0,0 +1,55 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/logging"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{logging.FormatText, `level=WARN msg="disk low" path=/ error="no space"`},
+		{logging.FormatJSON, `"level":"WARN","msg":"disk low","path":"/","error":"no space"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			logger, err := logging.New(&buf, tt.format, slog.LevelWarn)
+			if err != nil {
+				t.Fatalf("could not create logger, %v", err)
+			}
+
+			logger.Info("dropped")
+			logger.Warn("disk low", "path", "/", "error", errors.New("no space"))
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("got %d lines %q, want only the warning", len(lines), buf.String())
+			}
+
+			if !strings.HasSuffix(lines[0], tt.want) {
+				t.Errorf("got %q, want it to end with %q", lines[0], tt.want)
+			}
+
+			if tt.format == logging.FormatJSON && !json.Valid([]byte(lines[0])) {
+				t.Errorf("got invalid JSON %q", lines[0])
+			}
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		if _, err := logging.New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+			t.Error("got no error, want one")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RegisterDBStats registers gauges and counters for the connection pool of
+// db, read from sql.DBStats at every scrape, with names starting with
+// prefix.
+func RegisterDBStats(reg *Registry, prefix string, db *sql.DB) {
+	stat := func(f func(sql.DBStats) float64) func(context.Context) (float64, error) {
+		return func(context.Context) (float64, error) {
+			return f(db.Stats()), nil
+		}
+	}
+
+	reg.GaugeFunc(prefix+"_max_open_connections", "Maximum number of open connections to the database, 0 for no limit.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.GaugeFunc(prefix+"_open_connections", "Established connections, in use or idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.GaugeFunc(prefix+"_in_use_connections", "Connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.GaugeFunc(prefix+"_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.CounterFunc(prefix+"_wait_count_total", "Connections waited for because the pool was exhausted.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.CounterFunc(prefix+"_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.CounterFunc(prefix+"_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.CounterFunc(prefix+"_max_idle_time_closed_total", "Connections closed because they were idle for too long.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	reg.CounterFunc(prefix+"_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
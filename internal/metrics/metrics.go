@@ -0,0 +1,316 @@
+// Package metrics keeps counters, histograms and gauges and serves them in
+// the Prometheus text exposition format. It covers what the application
+// needs and nothing more: no summaries, no exemplars, no protobuf.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, suited to request
+// and query latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// contentType is the version of the text format written.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics of a process and serves them over HTTP. Metrics
+// are written in the order they were registered.
+type Registry struct {
+	// Logger is told about gauges and counters whose function fails. Those
+	// are left out of that scrape.
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+type family interface {
+	write(ctx context.Context, buf *bytes.Buffer) error
+}
+
+func NewRegistry(logger *slog.Logger) *Registry {
+	return &Registry{Logger: logger, names: map[string]bool{}}
+}
+
+// Counter registers a counter with the given label names.
+func (reg *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec[float64](name, help, labels)}
+	reg.register(name, c)
+	return c
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, which
+// must be in increasing order, and label names.
+func (reg *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not in increasing order", name))
+	}
+
+	h := &Histogram{vec: newVec[histogramSeries](name, help, labels), buckets: buckets}
+	reg.register(name, h)
+	return h
+}
+
+// GaugeFunc registers a gauge whose value is read from f at every scrape.
+func (reg *Registry) GaugeFunc(name, help string, f func(ctx context.Context) (float64, error)) {
+	reg.register(name, &funcFamily{name: name, help: help, typ: "gauge", f: f})
+}
+
+// CounterFunc registers a counter whose value is read from f at every
+// scrape, for totals something else already keeps.
+func (reg *Registry) CounterFunc(name, help string, f func(ctx context.Context) (float64, error)) {
+	reg.register(name, &funcFamily{name: name, help: help, typ: "counter", f: f})
+}
+
+func (reg *Registry) register(name string, f family) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.names[name] {
+		panic(fmt.Sprintf("metrics: %s is already registered", name))
+	}
+
+	reg.names[name] = true
+	reg.families = append(reg.families, f)
+}
+
+// WriteText writes every metric in the text format.
+func (reg *Registry) WriteText(ctx context.Context, buf *bytes.Buffer) {
+	reg.mu.Lock()
+	families := slices.Clone(reg.families)
+	reg.mu.Unlock()
+
+	for _, f := range families {
+		if err := f.write(ctx, buf); err != nil {
+			reg.Logger.Warn("collecting metric", slog.Any("error", err))
+		}
+	}
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	reg.WriteText(r.Context(), &buf)
+
+	w.Header().Set("Content-Type", contentType)
+	buf.WriteTo(w)
+}
+
+// vec is what counters and histograms share: a name, label names and one
+// series per combination of label values.
+type vec[S any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*S
+	values map[string][]string
+}
+
+func newVec[S any](name, help string, labels []string) vec[S] {
+	return vec[S]{name: name, help: help, labels: labels, series: map[string]*S{}, values: map[string][]string{}}
+}
+
+// get returns the series for labelValues, creating it with newSeries. The
+// caller must hold the lock.
+func (v *vec[S]) get(labelValues []string, newSeries func() *S) *S {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := v.series[key]
+	if !ok {
+		s = newSeries()
+		v.series[key] = s
+		v.values[key] = slices.Clone(labelValues)
+	}
+
+	return s
+}
+
+// each calls f for every series, ordered by label values. The caller must
+// hold the lock.
+func (v *vec[S]) each(f func(labelValues []string, s *S)) {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return slices.Compare(v.values[a], v.values[b])
+	})
+
+	for _, key := range keys {
+		f(v.values[key], v.series[key])
+	}
+}
+
+// Counter is a total that only goes up, split by labels.
+type Counter struct {
+	vec[float64]
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds n, which must not be negative, to the series with the given
+// label values.
+func (c *Counter) Add(n float64, labelValues ...string) {
+	if n < 0 {
+		panic(fmt.Sprintf("metrics: %s cannot go down", c.name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.get(labelValues, func() *float64 { return new(float64) }) += n
+}
+
+func (c *Counter) write(ctx context.Context, buf *bytes.Buffer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(buf, c.name, c.help, "counter")
+	c.each(func(labelValues []string, value *float64) {
+		writeSample(buf, c.name, c.labels, labelValues, "", "", *value)
+	})
+
+	return nil
+}
+
+// Histogram counts observations into buckets, split by labels.
+type Histogram struct {
+	vec[histogramSeries]
+	buckets []float64
+}
+
+type histogramSeries struct {
+	// counts holds the observations per bucket, not cumulative, with the
+	// last one for those above every bound.
+	counts []uint64
+	sum    float64
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues, func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+	})
+
+	i, _ := slices.BinarySearch(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+}
+
+func (h *Histogram) write(ctx context.Context, buf *bytes.Buffer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(buf, h.name, h.help, "histogram")
+	h.each(func(labelValues []string, s *histogramSeries) {
+		var cumulative uint64
+
+		for i, count := range s.counts {
+			cumulative += count
+
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+
+			writeSample(buf, h.name+"_bucket", h.labels, labelValues, "le", formatFloat(le), float64(cumulative))
+		}
+
+		writeSample(buf, h.name+"_sum", h.labels, labelValues, "", "", s.sum)
+		writeSample(buf, h.name+"_count", h.labels, labelValues, "", "", float64(cumulative))
+	})
+
+	return nil
+}
+
+// funcFamily is a single unlabelled value read at scrape time.
+type funcFamily struct {
+	name string
+	help string
+	typ  string
+	f    func(ctx context.Context) (float64, error)
+}
+
+func (f *funcFamily) write(ctx context.Context, buf *bytes.Buffer) error {
+	value, err := f.f(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	writeHeader(buf, f.name, f.help, f.typ)
+	writeSample(buf, f.name, nil, nil, "", "", value)
+
+	return nil
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(buf *bytes.Buffer, name, help, typ string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, typ)
+}
+
+// writeSample writes one line, with an extra label after the others when
+// extraName is set.
+func writeSample(buf *bytes.Buffer, name string, labels, labelValues []string, extraName, extraValue string, value float64) {
+	buf.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		buf.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, label, labelEscaper.Replace(labelValues[i]))
+		}
+
+		if extraName != "" {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, extraName, extraValue)
+		}
+
+		buf.WriteByte('}')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(value))
+	buf.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
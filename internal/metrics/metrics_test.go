@@ -0,0 +1,153 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/metrics"
+	_ "modernc.org/sqlite"
+)
+
+func TestRegistry(t *testing.T) {
+	var logs bytes.Buffer
+	reg := metrics.NewRegistry(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	requests := reg.Counter("requests_total", "Requests served.", "route", "status")
+	requests.Inc("/b", "200")
+	requests.Inc("/a", "404")
+	requests.Add(2, "/b", "200")
+	requests.Inc(`say "hi"\`+"\n", "200")
+
+	latency := reg.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	reg.GaugeFunc("temperature", "Line one.\nLine two \\ end.", func(context.Context) (float64, error) {
+		return -1.5, nil
+	})
+	reg.GaugeFunc("broken", "Never shown.", func(context.Context) (float64, error) {
+		return 0, errors.New("sensor offline")
+	})
+	reg.CounterFunc("restarts_total", "Restarts.", func(context.Context) (float64, error) {
+		return 7, nil
+	})
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",status="404"} 1
+requests_total{route="/b",status="200"} 3
+requests_total{route="say \"hi\"\\\n",status="200"} 1
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 3.65
+latency_seconds_count{route="/a"} 4
+# HELP temperature Line one.\nLine two \\ end.
+# TYPE temperature gauge
+temperature -1.5
+# HELP restarts_total Restarts.
+# TYPE restarts_total counter
+restarts_total 7
+`
+
+	if got := w.Body.String(); got != want {
+		t.Errorf("got body\n%s\nwant\n%s", got, want)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", got)
+	}
+
+	if !strings.Contains(logs.String(), "sensor offline") {
+		t.Errorf("got logs %q, want the failing gauge reported", logs.String())
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(reg *metrics.Registry)
+	}{
+		{
+			name: "duplicate name",
+			f: func(reg *metrics.Registry) {
+				reg.Counter("total", "")
+				reg.Histogram("total", "", metrics.DefaultBuckets)
+			},
+		},
+		{
+			name: "wrong number of label values",
+			f: func(reg *metrics.Registry) {
+				reg.Counter("total", "", "route").Inc()
+			},
+		},
+		{
+			name: "counter going down",
+			f: func(reg *metrics.Registry) {
+				reg.Counter("total", "").Add(-1)
+			},
+		},
+		{
+			name: "unsorted buckets",
+			f: func(reg *metrics.Registry) {
+				reg.Histogram("seconds", "", []float64{1, 0.5})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("got no panic, want one")
+				}
+			}()
+
+			tt.f(metrics.NewRegistry(slog.Default()))
+		})
+	}
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(3)
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := metrics.NewRegistry(slog.Default())
+	metrics.RegisterDBStats(reg, "app_db", db)
+
+	var buf bytes.Buffer
+	reg.WriteText(context.Background(), &buf)
+
+	for _, want := range []string{
+		"# TYPE app_db_max_open_connections gauge\napp_db_max_open_connections 3\n",
+		"app_db_open_connections 1\n",
+		"app_db_idle_connections 1\n",
+		"# TYPE app_db_wait_count_total counter\napp_db_wait_count_total 0\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+}
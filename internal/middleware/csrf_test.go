@@ -0,0 +1,136 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/middleware"
+)
+
+func TestCSRF(t *testing.T) {
+	var logs bytes.Buffer
+
+	csrf := middleware.NewCSRF(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	handler := csrf.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, middleware.CSRFToken(r))
+	}))
+
+	// A GET hands out the cookie and a token for the page's forms.
+	get := httptest.NewRecorder()
+	handler.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookies := get.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %v, want one HttpOnly csrf_token cookie", cookies)
+	}
+	cookie := cookies[0]
+	token := get.Body.String()
+
+	otherGet := httptest.NewRecorder()
+	handler.ServeHTTP(otherGet, httptest.NewRequest(http.MethodGet, "/", nil))
+	otherToken := otherGet.Body.String()
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		header     string
+		cookie     bool
+		maxBytes   int64
+		wantStatus int
+	}{
+		{
+			name:       "matching form field",
+			form:       url.Values{"csrf_token": {token}},
+			cookie:     true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "matching header",
+			header:     token,
+			cookie:     true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no token",
+			cookie:     true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "garbage token",
+			form:       url.Values{"csrf_token": {"garbage"}},
+			cookie:     true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "token for another cookie",
+			form:       url.Values{"csrf_token": {otherToken}},
+			cookie:     true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "token without its cookie",
+			form:       url.Values{"csrf_token": {token}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "form over the body limit",
+			form:       url.Values{"csrf_token": {token}, "content": {strings.Repeat("x", 100)}},
+			cookie:     true,
+			maxBytes:   64,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+			if tt.cookie {
+				r.AddCookie(cookie)
+			}
+
+			w := httptest.NewRecorder()
+			if tt.maxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, tt.maxBytes)
+			}
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if rejected := w.Code == http.StatusBadRequest; rejected != strings.Contains(logs.String(), `msg="CSRF check failed"`) {
+				t.Errorf("got log %q for status %d, want rejections and only them logged", logs.String(), w.Code)
+			}
+		})
+	}
+
+	t.Run("tokens are masked differently on every page", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookie)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Body.String() == token {
+			t.Error("got the same masked token twice")
+		}
+
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("got a new cookie although the request had a valid one")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds an ID taken from a client or proxy.
+const maxRequestIDLength = 64
+
+type requestIDContextKey struct{}
+
+// AssignRequestID is middleware that gives every request an ID, keeping the
+// one a proxy in front already set when it looks sane, and echoes it back in
+// the response so a user can quote it.
+func AssignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestID returns the ID AssignRequestID gave r, or "" if it did not pass
+// through it.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// Error is http.Error with the status text as the message, followed by the
+// request ID when r has one.
+func Error(w http.ResponseWriter, r *http.Request, status int) {
+	message := http.StatusText(status)
+	if id := RequestID(r); id != "" {
+		message += "\nRequest ID: " + id
+	}
+
+	http.Error(w, message, status)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never fails on supported platforms.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id is short and made only of characters
+// that are safe to log and send back in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
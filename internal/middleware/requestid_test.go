@@ -0,0 +1,128 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/middleware"
+)
+
+func TestAssignRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name     string
+		incoming string
+		// want is the ID expected to be kept, or empty for a new one.
+		want string
+	}{
+		{name: "no incoming ID"},
+		{name: "incoming ID is kept", incoming: "req-42_a.b", want: "req-42_a.b"},
+		{name: "ID with spaces is replaced", incoming: "a b"},
+		{name: "ID with a newline is replaced", incoming: "a\nlevel=ERROR"},
+		{name: "overlong ID is replaced", incoming: strings.Repeat("a", 65)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := middleware.AssignRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = middleware.RequestID(r)
+				middleware.Error(w, r, http.StatusTeapot)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get("X-Request-ID")
+
+			if tt.want != "" && got != tt.want {
+				t.Errorf("got ID %q, want %q", got, tt.want)
+			}
+
+			if tt.want == "" && !generated.MatchString(got) {
+				t.Errorf("got ID %q, want a generated one", got)
+			}
+
+			if seen != got {
+				t.Errorf("got ID %q in the handler and %q in the response", seen, got)
+			}
+
+			if want := "I'm a teapot\nRequest ID: " + got + "\n"; w.Body.String() != want {
+				t.Errorf("got body %q, want %q", w.Body.String(), want)
+			}
+		})
+	}
+
+	t.Run("requests without an ID get a plain error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		middleware.Error(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusNotFound)
+
+		if got := w.Body.String(); got != "Not Found\n" {
+			t.Errorf("got body %q, want %q", got, "Not Found\n")
+		}
+	})
+}
+
+func TestStatusRecorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int64
+	}{
+		{
+			name:       "nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "implicit 200",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "hello")
+				io.WriteString(w, " world")
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  11,
+		},
+		{
+			name: "first status wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, "gone")
+			},
+			wantStatus: http.StatusNotFound,
+			wantBytes:  4,
+		},
+		{
+			name: "status after a write is ignored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := middleware.NewStatusRecorder(httptest.NewRecorder())
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Status != tt.wantStatus || rec.Bytes != tt.wantBytes {
+				t.Errorf("got status %d and %d bytes, want %d and %d", rec.Status, rec.Bytes, tt.wantStatus, tt.wantBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import "net/http"
+
+// StatusRecorder is a ResponseWriter that remembers the status sent and
+// counts the body bytes written, for middleware that reports on responses.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int64
+
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rec *StatusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.Status = status
+		rec.wroteHeader = true
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *StatusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.Bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *StatusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
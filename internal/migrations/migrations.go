@@ -0,0 +1,429 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	ErrDirty        = errors.New("migrations: database is dirty, fix it by hand and then force a version")
+	ErrSchemaBehind = errors.New("migrations: database schema is behind, run migrate up")
+	ErrNoMigration  = errors.New("migrations: no such migration version")
+)
+
+// Migration is one numbered schema change, read from a pair of files named
+// like 0001_create_snippets_table.up.sql and 0001_create_snippets_table.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied bool
+	Dirty   bool
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Driver     string
+	Migrations []Migration
+}
+
+// New returns a Migrator loaded with the embedded migrations for driver.
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := Load(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Driver: driver, Migrations: migrations}, nil
+}
+
+// Load reads the embedded migrations for driver, ordered by version.
+func Load(driver string) ([]Migration, error) {
+	switch driver {
+	case database.DriverMySQL, database.DriverSQLite:
+	default:
+		return nil, fmt.Errorf("migrations: the %s driver has no migrations", driver)
+	}
+
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		version, name, direction, err := parseFilename(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := fs.ReadFile(files, path.Join(driver, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != name {
+			return nil, fmt.Errorf("migrations: version %d has two names, %q and %q", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the version the schema is at once every migration is applied.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version returns the highest applied version and whether the migration that
+// was last attempted failed half-way through.
+func (m *Migrator) Version() (int, bool, error) {
+	if err := m.ensureTable(); err != nil {
+		return 0, false, err
+	}
+
+	var version int
+	var dirty bool
+
+	row := m.DB.QueryRow(`SELECT version, dirty FROM schema_migrations ORDER BY version DESC LIMIT 1`)
+
+	err := row.Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range m.Migrations {
+		dirty, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, Dirty: dirty})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns how many ran.
+func (m *Migrator) Up() (int, error) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	count := 0
+	for _, migration := range m.Migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		if err := m.run(migration, migration.Up, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Down rolls back the n most recently applied migrations and returns how many
+// were rolled back.
+func (m *Migrator) Down(n int) (int, error) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	count := 0
+	for i := len(m.Migrations) - 1; i >= 0 && count < n; i-- {
+		migration := m.Migrations[i]
+		if migration.Version > version {
+			continue
+		}
+
+		if err := m.run(migration, migration.Down, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Force records the schema as being exactly at version without running any
+// SQL, clearing the dirty flag. It is the way out after a failed migration
+// has been repaired by hand. Version 0 marks everything as unapplied.
+func (m *Migrator) Force(version int) error {
+	if version != 0 && !m.known(version) {
+		return ErrNoMigration
+	}
+
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES(?, ?)`, migration.Version, false); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CurrentVersion is Version without the side effects, for callers that only
+// look: it never creates schema_migrations, taking a database without it to
+// be at version 0, and it stops when ctx is done.
+func (m *Migrator) CurrentVersion(ctx context.Context) (int, bool, error) {
+	var exists int
+
+	stmt := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'`
+	if m.Driver == database.DriverSQLite {
+		stmt = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	}
+
+	if err := m.DB.QueryRowContext(ctx, stmt).Scan(&exists); err != nil {
+		return 0, false, err
+	}
+
+	if exists == 0 {
+		return 0, false, nil
+	}
+
+	var version int
+	var dirty bool
+
+	row := m.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations ORDER BY version DESC LIMIT 1`)
+
+	err := row.Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
+
+// CheckCurrent returns ErrSchemaBehind unless every migration is applied.
+// It only reads, so it is safe to call as often as a readiness probe does.
+func (m *Migrator) CheckCurrent(ctx context.Context) error {
+	version, dirty, err := m.CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return ErrDirty
+	}
+
+	if version < m.Latest() {
+		return fmt.Errorf("%w: at version %d, want %d", ErrSchemaBehind, version, m.Latest())
+	}
+
+	return nil
+}
+
+// run executes one direction of a migration. The version is marked dirty
+// first so that a failure part way through, which MySQL cannot roll back for
+// DDL, is noticed by the next run.
+func (m *Migrator) run(migration Migration, body string, up bool) error {
+	if up {
+		_, err := m.DB.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES(?, ?)`, migration.Version, true)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := m.DB.Exec(`UPDATE schema_migrations SET dirty = ? WHERE version = ?`, true, migration.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range m.statements(body) {
+		if _, err := m.DB.Exec(stmt); err != nil {
+			return fmt.Errorf("migrations: version %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	var err error
+	if up {
+		_, err = m.DB.Exec(`UPDATE schema_migrations SET dirty = ? WHERE version = ?`, false, migration.Version)
+	} else {
+		_, err = m.DB.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	}
+
+	return err
+}
+
+// statements splits a migration into the statements to execute. SQLite takes
+// the whole file at once, which keeps trigger bodies intact. The MySQL driver
+// only runs one statement per call, so there every statement must end with a
+// semicolon at the end of a line.
+func (m *Migrator) statements(body string) []string {
+	if m.Driver == database.DriverSQLite {
+		return []string{body}
+	}
+
+	stmts := []string{}
+	for _, stmt := range strings.Split(body, ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	return stmts
+}
+
+func (m *Migrator) applied() (map[int]bool, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, dirty FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := map[int]bool{}
+
+	for rows.Next() {
+		var version int
+		var dirty bool
+
+		if err := rows.Scan(&version, &dirty); err != nil {
+			return nil, err
+		}
+
+		applied[version] = dirty
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		dirty BOOLEAN NOT NULL
+	)`)
+
+	return err
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseFilename(filename string) (int, string, string, error) {
+	var direction string
+
+	switch {
+	case strings.HasSuffix(filename, ".up.sql"):
+		direction = "up"
+	case strings.HasSuffix(filename, ".down.sql"):
+		direction = "down"
+	default:
+		return 0, "", "", fmt.Errorf("migrations: %s must end in .up.sql or .down.sql", filename)
+	}
+
+	base := strings.TrimSuffix(filename, "."+direction+".sql")
+
+	number, name, ok := strings.Cut(base, "_")
+	if !ok {
+		return 0, "", "", fmt.Errorf("migrations: %s must be named <version>_<name>", filename)
+	}
+
+	version, err := strconv.Atoi(number)
+	if err != nil || version < 1 {
+		return 0, "", "", fmt.Errorf("migrations: %s has an invalid version", filename)
+	}
+
+	return version, name, direction, nil
+}
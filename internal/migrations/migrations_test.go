@@ -0,0 +1,207 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	mysqlMigrations, err := migrations.Load(database.DriverMySQL)
+	if err != nil {
+		t.Fatalf("could not load mysql migrations, %v", err)
+	}
+
+	sqliteMigrations, err := migrations.Load(database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("could not load sqlite migrations, %v", err)
+	}
+
+	if len(mysqlMigrations) != len(sqliteMigrations) {
+		t.Fatalf("got %d mysql migrations and %d sqlite migrations, want the same number", len(mysqlMigrations), len(sqliteMigrations))
+	}
+
+	for i := range mysqlMigrations {
+		if wantVersion := i + 1; mysqlMigrations[i].Version != wantVersion {
+			t.Errorf("got migration version %d at position %d, want %d", mysqlMigrations[i].Version, i, wantVersion)
+		}
+
+		if mysqlMigrations[i].Name != sqliteMigrations[i].Name {
+			t.Errorf("got mysql migration %q and sqlite migration %q for version %d", mysqlMigrations[i].Name, sqliteMigrations[i].Name, mysqlMigrations[i].Version)
+		}
+	}
+
+	if _, err := migrations.Load(database.DriverMemory); err == nil {
+		t.Error("Expected error loading migrations for the memory driver, got nil")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	t.Run("current version only reads the schema", func(t *testing.T) {
+		migrator := setMigrator(t)
+
+		version, dirty, err := migrator.CurrentVersion(context.Background())
+		if err != nil || version != 0 || dirty {
+			t.Errorf("got version %d, dirty %t and error %v before migrating, want 0, false and nil", version, dirty, err)
+		}
+
+		var tables int
+		if err := migrator.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`).Scan(&tables); err != nil {
+			t.Fatalf("could not list tables, %v", err)
+		}
+
+		if tables != 0 {
+			t.Error("got schema_migrations created by a read")
+		}
+
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("could not migrate up, %v", err)
+		}
+
+		version, _, err = migrator.CurrentVersion(context.Background())
+		if err != nil || version != migrator.Latest() {
+			t.Errorf("got version %d and error %v after migrating, want %d", version, err, migrator.Latest())
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, _, err := migrator.CurrentVersion(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v with a canceled context, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("up applies every migration", func(t *testing.T) {
+		migrator := setMigrator(t)
+
+		if err := migrator.CheckCurrent(context.Background()); !errors.Is(err, migrations.ErrSchemaBehind) {
+			t.Errorf("got error %v, want %v", err, migrations.ErrSchemaBehind)
+		}
+
+		count, err := migrator.Up()
+		if err != nil {
+			t.Fatalf("could not migrate up, %v", err)
+		}
+
+		if count != len(migrator.Migrations) {
+			t.Errorf("got %d migrations applied, want %d", count, len(migrator.Migrations))
+		}
+
+		if err := migrator.CheckCurrent(context.Background()); err != nil {
+			t.Errorf("got error %v after migrating up, want nil", err)
+		}
+
+		if _, err := migrator.DB.Exec(`SELECT id FROM snippets`); err != nil {
+			t.Errorf("could not query snippets table, %v", err)
+		}
+
+		count, _ = migrator.Up()
+		if count != 0 {
+			t.Errorf("got %d migrations applied on second run, want 0", count)
+		}
+	})
+
+	t.Run("down rolls back migrations", func(t *testing.T) {
+		migrator := setMigrator(t)
+		migrator.Up()
+
+		count, err := migrator.Down(len(migrator.Migrations))
+		if err != nil {
+			t.Fatalf("could not migrate down, %v", err)
+		}
+
+		if count != len(migrator.Migrations) {
+			t.Errorf("got %d migrations rolled back, want %d", count, len(migrator.Migrations))
+		}
+
+		version, _, _ := migrator.Version()
+		if version != 0 {
+			t.Errorf("got version %d, want 0", version)
+		}
+
+		if _, err := migrator.DB.Exec(`SELECT id FROM snippets`); err == nil {
+			t.Error("Expected snippets table to be dropped")
+		}
+	})
+
+	t.Run("status reports applied and pending migrations", func(t *testing.T) {
+		migrator := setMigrator(t)
+		migrator.Migrations = append(migrator.Migrations, migrations.Migration{
+			Version: migrator.Latest() + 1,
+			Name:    "pending",
+			Up:      "SELECT 1",
+			Down:    "SELECT 1",
+		})
+		migrator.Up()
+		migrator.Down(1)
+
+		statuses, err := migrator.Status()
+		if err != nil {
+			t.Fatalf("could not get status, %v", err)
+		}
+
+		for i, status := range statuses {
+			wantApplied := i < len(statuses)-1
+			if status.Applied != wantApplied {
+				t.Errorf("got migration %d applied %v, want %v", status.Version, status.Applied, wantApplied)
+			}
+		}
+	})
+
+	t.Run("failed migration leaves the database dirty until forced", func(t *testing.T) {
+		migrator := setMigrator(t)
+		migrator.Up()
+
+		broken := migrator.Latest() + 1
+		migrator.Migrations = append(migrator.Migrations, migrations.Migration{
+			Version: broken,
+			Name:    "broken",
+			Up:      "NOT VALID SQL",
+			Down:    "SELECT 1",
+		})
+
+		if _, err := migrator.Up(); err == nil {
+			t.Fatal("Expected error applying broken migration, got nil")
+		}
+
+		if _, err := migrator.Up(); !errors.Is(err, migrations.ErrDirty) {
+			t.Errorf("got error %v, want %v", err, migrations.ErrDirty)
+		}
+
+		if err := migrator.Force(broken - 1); err != nil {
+			t.Fatalf("could not force version, %v", err)
+		}
+
+		version, dirty, _ := migrator.Version()
+		if version != broken-1 || dirty {
+			t.Errorf("got version %d dirty %v, want version %d clean", version, dirty, broken-1)
+		}
+	})
+
+	t.Run("force to unknown version", func(t *testing.T) {
+		migrator := setMigrator(t)
+
+		if err := migrator.Force(999); !errors.Is(err, migrations.ErrNoMigration) {
+			t.Errorf("got error %v, want %v", err, migrations.ErrNoMigration)
+		}
+	})
+}
+
+func setMigrator(t testing.TB) *migrations.Migrator {
+	t.Helper()
+	db, err := database.OpenDB(database.DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("could not open sqlite db, %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("could not load migrations, %v", err)
+	}
+
+	return migrator
+}
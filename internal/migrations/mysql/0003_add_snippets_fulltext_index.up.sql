@@ -0,0 +1 @@
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets(title, content);
@@ -0,0 +1,5 @@
+ALTER TABLE snippets DROP FOREIGN KEY fk_snippets_user;
+
+ALTER TABLE snippets DROP COLUMN user_id;
+
+DROP TABLE users;
@@ -0,0 +1,7 @@
+CREATE TABLE sessions (
+    token CHAR(43) NOT NULL PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry BIGINT NOT NULL
+);
+
+CREATE INDEX idx_sessions_expiry ON sessions(expiry);
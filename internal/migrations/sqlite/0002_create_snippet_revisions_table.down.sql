@@ -0,0 +1,3 @@
+DROP TABLE snippet_revisions;
+
+ALTER TABLE snippets DROP COLUMN revision;
@@ -0,0 +1,13 @@
+ALTER TABLE snippets ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE snippet_revisions (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+SELECT id, revision, title, content, created FROM snippets;
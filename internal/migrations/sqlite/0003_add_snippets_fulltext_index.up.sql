@@ -0,0 +1,18 @@
+-- An external content FTS5 table indexes the snippets table without storing
+-- a second copy of the text. The triggers keep the index in step with it.
+CREATE VIRTUAL TABLE snippets_fts USING fts5(title, content, content='snippets', content_rowid='id');
+
+CREATE TRIGGER snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER snippets_fts_update AFTER UPDATE ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO snippets_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+INSERT INTO snippets_fts (snippets_fts) VALUES ('rebuild');
@@ -0,0 +1,13 @@
+CREATE TABLE api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    hash BLOB NOT NULL,
+    scopes TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME,
+    last_used DATETIME,
+    CONSTRAINT api_tokens_uc_hash UNIQUE (hash)
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryBucket struct {
+	Bucket
+	budget Budget
+}
+
+// MemoryStore keeps buckets in the process, so every instance has its own
+// and they start over on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewMemoryStore returns an empty MemoryStore that forgets idle buckets
+// every cleanupInterval. Zero disables the cleanup, so every key seen stays
+// in memory.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+
+	if cleanupInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stop = cancel
+		s.done = make(chan struct{})
+
+		go func() {
+			defer close(s.done)
+
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					s.DeleteIdle()
+				}
+			}
+		}()
+	}
+
+	return s
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, budget Budget) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{Bucket: NewBucket(budget, now)}
+		s.buckets[key] = b
+	}
+	b.budget = budget
+
+	return b.Take(budget, now), nil
+}
+
+func (s *MemoryStore) Refund(ctx context.Context, key string, budget Budget) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A bucket that is gone has been forgotten as full, which a refund
+	// would leave it anyway.
+	if b, ok := s.buckets[key]; ok {
+		b.Refund(budget, time.Now())
+	}
+
+	return nil
+}
+
+// DeleteIdle forgets every bucket that has refilled completely.
+func (s *MemoryStore) DeleteIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, b := range s.buckets {
+		if b.Idle(b.budget, now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns how many buckets are kept.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
+
+// StopCleanup stops the background cleanup and waits for it to exit.
+func (s *MemoryStore) StopCleanup() {
+	if s.stop == nil {
+		return
+	}
+
+	s.stop()
+	<-s.done
+}
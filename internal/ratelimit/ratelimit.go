@@ -0,0 +1,164 @@
+// Package ratelimit keeps token buckets by key. A bucket holds up to a
+// budget's Limit tokens and refills at Limit per Period, so a client can
+// burst through the whole budget at once and then continues at the average
+// rate.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidBudget = errors.New(`ratelimit: budget must look like "10/1m", or be "off"`)
+
+// Budget allows Limit requests per Period. The zero Budget is unlimited.
+type Budget struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (b Budget) Unlimited() bool {
+	return b.Limit <= 0 || b.Period <= 0
+}
+
+func (b Budget) String() string {
+	if b.Unlimited() {
+		return "off"
+	}
+
+	// Drop the zero units Duration.String adds, so 1m is not 1m0s.
+	period := b.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+
+	return fmt.Sprintf("%d/%s", b.Limit, period)
+}
+
+// MarshalText and UnmarshalText let a Budget be a flag.TextVar, written like
+// "10/1m" or "off".
+func (b Budget) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *Budget) UnmarshalText(text []byte) error {
+	if string(text) == "off" {
+		*b = Budget{}
+		return nil
+	}
+
+	limit, period, ok := strings.Cut(string(text), "/")
+	if !ok {
+		return ErrInvalidBudget
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return ErrInvalidBudget
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return ErrInvalidBudget
+	}
+
+	*b = Budget{Limit: n, Period: d}
+
+	return nil
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the budget's Limit, and Remaining the whole tokens left.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Take takes a token from the bucket for key,
+// creating it full when there is none, and Refund puts back one that Take
+// took, for requests that turn out not to count.
+type Store interface {
+	Take(ctx context.Context, key string, budget Budget) (Result, error)
+	Refund(ctx context.Context, key string, budget Budget) error
+}
+
+// Bucket is the state a Store keeps per key. Tokens is the count at Updated;
+// the refill since then is worked out on the next Take, so a shared Store
+// only needs to save the two fields atomically.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// NewBucket returns a full bucket for budget.
+func NewBucket(budget Budget, now time.Time) Bucket {
+	return Bucket{Tokens: float64(budget.Limit), Updated: now}
+}
+
+// Take refills the bucket up to now and takes a token from it if one is
+// there.
+func (b *Bucket) Take(budget Budget, now time.Time) Result {
+	b.refill(budget, now)
+
+	allowed := b.Tokens >= 1
+	if allowed {
+		b.Tokens--
+	}
+
+	return b.result(budget, allowed)
+}
+
+// Refund refills the bucket up to now and puts a token back, never beyond
+// the budget's Limit.
+func (b *Bucket) Refund(budget Budget, now time.Time) {
+	b.refill(budget, now)
+	b.Tokens = math.Min(float64(budget.Limit), b.Tokens+1)
+}
+
+func (b *Bucket) refill(budget Budget, now time.Time) {
+	rate := float64(budget.Limit) / budget.Period.Seconds()
+
+	if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(budget.Limit), b.Tokens+elapsed*rate)
+		b.Updated = now
+	}
+}
+
+func (b *Bucket) result(budget Budget, allowed bool) Result {
+	rate := float64(budget.Limit) / budget.Period.Seconds()
+
+	result := Result{Allowed: allowed, Limit: budget.Limit}
+
+	if !allowed {
+		result.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+
+	result.Remaining = int(b.Tokens)
+	result.Reset = seconds((float64(budget.Limit) - b.Tokens) / rate)
+
+	return result
+}
+
+// Idle reports whether the bucket would be full by now, and so can be
+// forgotten: a new full one behaves the same.
+func (b *Bucket) Idle(budget Budget, now time.Time) bool {
+	rate := float64(budget.Limit) / budget.Period.Seconds()
+	return b.Tokens+now.Sub(b.Updated).Seconds()*rate >= float64(budget.Limit)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,146 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/ratelimit"
+)
+
+func TestBudgetText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    ratelimit.Budget
+		wantErr error
+	}{
+		{text: "10/1m", want: ratelimit.Budget{Limit: 10, Period: time.Minute}},
+		{text: "30/1h", want: ratelimit.Budget{Limit: 30, Period: time.Hour}},
+		{text: "5/1h30m", want: ratelimit.Budget{Limit: 5, Period: 90 * time.Minute}},
+		{text: "1/500ms", want: ratelimit.Budget{Limit: 1, Period: 500 * time.Millisecond}},
+		{text: "off", want: ratelimit.Budget{}},
+		{text: "10", wantErr: ratelimit.ErrInvalidBudget},
+		{text: "0/1m", wantErr: ratelimit.ErrInvalidBudget},
+		{text: "10/0s", wantErr: ratelimit.ErrInvalidBudget},
+		{text: "ten/1m", wantErr: ratelimit.ErrInvalidBudget},
+		{text: "10/minute", wantErr: ratelimit.ErrInvalidBudget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got ratelimit.Budget
+			err := got.UnmarshalText([]byte(tt.text))
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got budget %+v, want %+v", got, tt.want)
+			}
+
+			if err == nil && got.String() != tt.text {
+				t.Errorf("got %q back, want %q", got.String(), tt.text)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	budget := ratelimit.Budget{Limit: 3, Period: 3 * time.Second}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := ratelimit.NewBucket(budget, start)
+
+	steps := []struct {
+		after         time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+		wantRetry     time.Duration
+	}{
+		// The whole budget can be spent at once.
+		{0, true, 2, time.Second, 0},
+		{0, true, 1, 2 * time.Second, 0},
+		{0, true, 0, 3 * time.Second, 0},
+		{0, false, 0, 3 * time.Second, time.Second},
+		// Then a token comes back every second.
+		{500 * time.Millisecond, false, 0, 2500 * time.Millisecond, 500 * time.Millisecond},
+		{time.Second, true, 0, 2500 * time.Millisecond, 0},
+		// And the bucket never holds more than the limit.
+		{time.Hour, true, 2, time.Second, 0},
+	}
+
+	now := start
+	for i, step := range steps {
+		now = now.Add(step.after)
+		got := bucket.Take(budget, now)
+
+		if got.Allowed != step.wantAllowed || got.Remaining != step.wantRemaining || got.Limit != 3 {
+			t.Errorf("step %d: got %+v, want allowed %t with %d of 3 left", i, got, step.wantAllowed, step.wantRemaining)
+		}
+
+		if got.Reset != step.wantReset || got.RetryAfter != step.wantRetry {
+			t.Errorf("step %d: got reset %v and retry after %v, want %v and %v", i, got.Reset, got.RetryAfter, step.wantReset, step.wantRetry)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	budget := ratelimit.Budget{Limit: 2, Period: 100 * time.Millisecond}
+
+	t.Run("keys have separate buckets", func(t *testing.T) {
+		store := ratelimit.NewMemoryStore(0)
+
+		for _, key := range []string{"a", "a", "b", "b"} {
+			if result, _ := store.Take(context.Background(), key, budget); !result.Allowed {
+				t.Errorf("got %s refused, want allowed", key)
+			}
+		}
+
+		if result, _ := store.Take(context.Background(), "a", budget); result.Allowed {
+			t.Error("got a allowed past its budget, want refused")
+		}
+	})
+
+	t.Run("refunds put taken tokens back", func(t *testing.T) {
+		store := ratelimit.NewMemoryStore(0)
+		budget := ratelimit.Budget{Limit: 2, Period: time.Hour}
+
+		for range 5 {
+			store.Take(context.Background(), "a", budget)
+			store.Refund(context.Background(), "a", budget)
+		}
+
+		if result, _ := store.Take(context.Background(), "a", budget); !result.Allowed || result.Remaining != 1 {
+			t.Errorf("got %+v after refunded takes, want allowed with 1 left", result)
+		}
+
+		for range 5 {
+			store.Refund(context.Background(), "a", budget)
+		}
+
+		if result, _ := store.Take(context.Background(), "a", budget); result.Remaining != 1 {
+			t.Errorf("got %d remaining after extra refunds, want the bucket capped at its limit", result.Remaining)
+		}
+	})
+
+	t.Run("idle buckets are forgotten", func(t *testing.T) {
+		store := ratelimit.NewMemoryStore(20 * time.Millisecond)
+		defer store.StopCleanup()
+
+		store.Take(context.Background(), "busy", budget)
+		store.Take(context.Background(), "busy", budget)
+		store.Take(context.Background(), "quiet", ratelimit.Budget{Limit: 2, Period: time.Hour})
+
+		if got := store.Len(); got != 2 {
+			t.Fatalf("got %d buckets, want 2", got)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		if got := store.Len(); got != 1 {
+			t.Errorf("got %d buckets after the busy one refilled, want only the quiet one", got)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/middleware"
+	"github.com/justinas/alice"
+)
+
+// apiPrefix is where the JSON API lives. Requests under it get JSON errors,
+// even for routes that do not exist.
+const apiPrefix = "/api/"
+
+// maxJSONBytes bounds the body of an API request.
+const maxJSONBytes = 1 << 20
+
+// apiSnippet is a snippet as the API returns it.
+type apiSnippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Revision int       `json:"revision"`
+}
+
+// apiLinks points to the neighbouring pages of a listing. A missing link
+// means there is no page that way.
+type apiLinks struct {
+	Newer string `json:"newer,omitempty"`
+	Older string `json:"older,omitempty"`
+}
+
+// apiError is the body of every API error. Fields holds the message for each
+// invalid field of a rejected snippet, and RequestID is there to be quoted
+// when reporting a problem.
+type apiError struct {
+	Status    int               `json:"status"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+func newAPISnippet(snippet *database.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:       snippet.ID,
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.Language,
+		Created:  snippet.Created,
+		Expires:  snippet.Expires,
+		Revision: snippet.Revision,
+	}
+}
+
+// apiListSnippetsHandler returns a page of the latest snippets, paged with
+// the same before, after and limit parameters as the home page.
+func (app *Application) apiListSnippetsHandler(w http.ResponseWriter, r *http.Request) {
+	cursor, ok := pageCursor(r.URL.Query())
+	if !ok {
+		app.apiError(w, r, http.StatusBadRequest, "before, after and limit must be positive integers, and before and after cannot be combined", nil)
+		return
+	}
+
+	snippets, err := app.SnippetStore.Latest(r.Context(), lookahead(cursor))
+	if err != nil {
+		app.apiDatabaseError(w, r, err)
+		return
+	}
+
+	snippets, pagination := paginate(snippets, cursor, "/api/v1/snippets", url.Values{})
+
+	response := struct {
+		Snippets []apiSnippet `json:"snippets"`
+		Links    apiLinks     `json:"links"`
+	}{
+		Snippets: []apiSnippet{},
+	}
+
+	for _, snippet := range snippets {
+		response.Snippets = append(response.Snippets, newAPISnippet(snippet))
+	}
+
+	if pagination != nil {
+		response.Links = apiLinks{Newer: pagination.Newer, Older: pagination.Older}
+	}
+
+	app.writeJSON(w, r, http.StatusOK, response)
+}
+
+func (app *Application) apiGetSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := routeID(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	snippet, err := app.SnippetStore.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiDatabaseError(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, map[string]apiSnippet{"snippet": newAPISnippet(snippet)})
+}
+
+// apiCreateSnippetHandler creates a snippet from a JSON object with the same
+// fields and rules as the create form, answering 201 with the new snippet.
+func (app *Application) apiCreateSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.apiError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit), nil)
+		} else {
+			app.apiError(w, r, http.StatusBadRequest, err.Error(), nil)
+		}
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.apiError(w, r, http.StatusUnprocessableEntity, "the snippet is invalid", form.FieldErrors)
+		return
+	}
+
+	id, err := app.SnippetStore.Insert(r.Context(), form.Title, form.Content, form.Language, form.Expires, app.apiToken(r).UserID)
+	if err != nil {
+		app.apiDatabaseError(w, r, err)
+		return
+	}
+
+	snippet, err := app.SnippetStore.Get(r.Context(), id)
+	if err != nil {
+		app.apiDatabaseError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.writeJSON(w, r, http.StatusCreated, map[string]apiSnippet{"snippet": newAPISnippet(snippet)})
+}
+
+// authenticateAPI resolves the bearer token of an API request, answering
+// 401 when it is missing, unknown or expired. Using it is recorded as the
+// token's last use.
+func (app *Application) authenticateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		plaintext, ok := bearerToken(r)
+		if !ok {
+			app.apiUnauthorized(w, r, "an API token is required in an \"Authorization: Bearer\" header")
+			return
+		}
+
+		token, err := app.TokenStore.Authenticate(r.Context(), plaintext)
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidToken) {
+				app.apiUnauthorized(w, r, "the API token is invalid or has expired")
+			} else {
+				app.apiDatabaseError(w, r, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiTokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope returns middleware that answers 403 unless the request's
+// token, checked by authenticateAPI before it, was granted scope.
+func (app *Application) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.apiToken(r).HasScope(scope) {
+				app.apiError(w, r, http.StatusForbidden, fmt.Sprintf("the API token needs the %s scope", scope), nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiToken returns the token authenticateAPI found for r.
+func (app *Application) apiToken(r *http.Request) *database.Token {
+	token, ok := r.Context().Value(apiTokenContextKey).(*database.Token)
+	if !ok {
+		panic("server: no API token in the request context, is authenticateAPI missing?")
+	}
+
+	return token
+}
+
+func (app *Application) apiUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiError(w, r, http.StatusUnauthorized, message, nil)
+}
+
+func (app *Application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	body, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func (app *Application) apiError(w http.ResponseWriter, r *http.Request, status int, message string, fields map[string]string) {
+	app.writeJSON(w, r, status, map[string]apiError{"error": {
+		Status:    status,
+		Message:   message,
+		Fields:    fields,
+		RequestID: middleware.RequestID(r),
+	}})
+}
+
+func (app *Application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, r, http.StatusNotFound, "the requested resource could not be found", nil)
+}
+
+// apiDatabaseError is databaseError for the API, with the same statuses.
+func (app *Application) apiDatabaseError(w http.ResponseWriter, r *http.Request, err error) {
+	var status int
+
+	switch {
+	case errors.Is(err, database.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, database.ErrCanceled):
+		status = http.StatusServiceUnavailable
+	default:
+		app.logServerError(r, err)
+		app.apiError(w, r, http.StatusInternalServerError, "internal server error", nil)
+		return
+	}
+
+	app.Logger.Warn("database unavailable", requestAttrs(r, err, slog.Int("status", status))...)
+
+	app.apiError(w, r, status, strings.ToLower(http.StatusText(status)), nil)
+}
+
+// readJSON decodes a request body holding exactly one JSON object into dst,
+// rejecting fields dst does not have. Its errors are fit to show the client.
+func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON at character %d", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &typeError):
+			if typeError.Field != "" {
+				return fmt.Errorf("body has the wrong type for field %q", typeError.Field)
+			}
+			return fmt.Errorf("body has the wrong type at character %d", typeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body has unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return err
+		}
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only hold a single JSON value")
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/session"
+	"github.com/go-playground/form/v4"
+)
+
+// apiResponse holds whichever of the API's top-level keys a response has.
+type apiResponse struct {
+	Snippet  *apiSnippet  `json:"snippet"`
+	Snippets []apiSnippet `json:"snippets"`
+	Links    struct {
+		Newer string `json:"newer"`
+		Older string `json:"older"`
+	} `json:"links"`
+	Error *struct {
+		Status    int               `json:"status"`
+		Message   string            `json:"message"`
+		Fields    map[string]string `json:"fields"`
+		RequestID string            `json:"request_id"`
+	} `json:"error"`
+}
+
+type apiSnippet struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Language string `json:"language"`
+}
+
+func newAPITestApp(store database.Store) *server.Application {
+	return &server.Application{
+		Logger:       testApp.Logger,
+		SnippetStore: store,
+		UserStore:    database.NewMemoryUserStore(),
+		TokenStore:   database.NewMemoryTokenStore(),
+		Sessions:     session.New(session.NewMemoryStore(0)),
+		FormDecoder:  form.NewDecoder(),
+	}
+}
+
+// newAPIToken creates a user for app and returns their id and a token with
+// the given scopes.
+func newAPIToken(t testing.TB, app *server.Application, email string, scopes ...string) (int, string) {
+	t.Helper()
+	userID, err := app.UserStore.Insert(context.Background(), "API user", email, "pa55word")
+	if err != nil {
+		t.Fatalf("could not insert user, %v", err)
+	}
+
+	token, err := app.TokenStore.Insert(context.Background(), userID, "test", scopes, time.Time{})
+	if err != nil {
+		t.Fatalf("could not insert token, %v", err)
+	}
+
+	return userID, token
+}
+
+func serveAPI(t testing.TB, handler http.Handler, token string, method string, path string, body string) (int, http.Header, apiResponse) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q, want application/json", got)
+	}
+
+	var response apiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not decode response %q, %v", w.Body.String(), err)
+	}
+
+	return w.Code, w.Header(), response
+}
+
+func TestAPISnippets(t *testing.T) {
+	store := database.NewMemoryStore()
+	for i := 0; i < 3; i++ {
+		store.Insert(context.Background(), fmt.Sprintf("title%d", i+1), "content", "", 7, 0)
+	}
+
+	app := newAPITestApp(store)
+	userID, token := newAPIToken(t, app, "api@example.com", database.ScopeRead, database.ScopeWrite)
+	_, readOnly := newAPIToken(t, app, "reader@example.com", database.ScopeRead)
+	handler := app.NewServeMux()
+
+	t.Run("GET lists the latest snippets with links to other pages", func(t *testing.T) {
+		status, _, response := serveAPI(t, handler, token, http.MethodGet, "/api/v1/snippets?limit=2", "")
+
+		assertResponseCode(t, status, http.StatusOK)
+
+		if len(response.Snippets) != 2 || response.Snippets[0].ID != 3 || response.Snippets[1].ID != 2 {
+			t.Errorf("got snippets %+v, want 3 and 2", response.Snippets)
+		}
+
+		if want := "/api/v1/snippets?before=2&limit=2"; response.Links.Older != want || response.Links.Newer != "" {
+			t.Errorf("got links %+v, want only older %s", response.Links, want)
+		}
+	})
+
+	t.Run("GET /:id returns the snippet", func(t *testing.T) {
+		status, _, response := serveAPI(t, handler, token, http.MethodGet, "/api/v1/snippets/1", "")
+
+		assertResponseCode(t, status, http.StatusOK)
+
+		if response.Snippet == nil || response.Snippet.Title != "title1" || response.Snippet.Content != "content" {
+			t.Errorf("got snippet %+v, want title1", response.Snippet)
+		}
+	})
+
+	t.Run("POST creates a snippet", func(t *testing.T) {
+		status, header, response := serveAPI(t, handler, token, http.MethodPost, "/api/v1/snippets", `{"title": "From a script", "content": "echo hi", "language": "shell", "expires": 7}`)
+
+		assertResponseCode(t, status, http.StatusCreated)
+
+		if got, want := header.Get("Location"), "/api/v1/snippets/4"; got != want {
+			t.Errorf("got Location %s, want %s", got, want)
+		}
+
+		if response.Snippet == nil || response.Snippet.ID != 4 || response.Snippet.Title != "From a script" || response.Snippet.Language != "shell" {
+			t.Errorf("got snippet %+v, want the new snippet", response.Snippet)
+		}
+
+		snippet, err := store.Get(context.Background(), 4)
+		if err != nil {
+			t.Fatalf("could not get the created snippet, %v", err)
+		}
+
+		if snippet.UserID != userID {
+			t.Errorf("got author %d, want the token's user %d", snippet.UserID, userID)
+		}
+	})
+
+	t.Run("a missing or unknown token returns 401", func(t *testing.T) {
+		for _, token := range []string{"", "sbx_unknown"} {
+			status, header, response := serveAPI(t, handler, token, http.MethodGet, "/api/v1/snippets", "")
+
+			assertResponseCode(t, status, http.StatusUnauthorized)
+
+			if got := header.Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("got WWW-Authenticate %q, want Bearer", got)
+			}
+
+			if response.Error == nil || response.Error.Status != http.StatusUnauthorized {
+				t.Errorf("got error %+v, want status 401", response.Error)
+			}
+		}
+	})
+
+	t.Run("a token without the write scope cannot create snippets", func(t *testing.T) {
+		status, _, response := serveAPI(t, handler, readOnly, http.MethodPost, "/api/v1/snippets", `{"title": "t", "content": "c", "expires": 1}`)
+
+		assertResponseCode(t, status, http.StatusForbidden)
+
+		if response.Error == nil || response.Error.Status != http.StatusForbidden {
+			t.Errorf("got error %+v, want status 403", response.Error)
+		}
+
+		if status, _, _ := serveAPI(t, handler, readOnly, http.MethodGet, "/api/v1/snippets/1", ""); status != http.StatusOK {
+			t.Errorf("got status %d reading with a read-only token, want 200", status)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantFields map[string]string
+	}{
+		{
+			name:       "invalid snippet lists every bad field",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": "", "content": "content", "language": "cobol", "expires": 2}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: map[string]string{
+				"title":    "This field cannot be blank",
+				"language": "This field must be a supported language",
+				"expires":  "This field must be 1, 7 or 365",
+			},
+		},
+		{
+			name:       "badly-formed JSON",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown field",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": "t", "content": "c", "expires": 1, "id": 9}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong type",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": "t", "content": "c", "expires": "soon"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "two JSON values",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": "t", "content": "c", "expires": 1}{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty body",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "body too large",
+			method:     http.MethodPost,
+			path:       "/api/v1/snippets",
+			body:       `{"title": "t", "content": "` + strings.Repeat("x", 1<<20) + `", "expires": 1}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "missing snippet",
+			method:     http.MethodGet,
+			path:       "/api/v1/snippets/99",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid id",
+			method:     http.MethodGet,
+			path:       "/api/v1/snippets/abc",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid cursor",
+			method:     http.MethodGet,
+			path:       "/api/v1/snippets?before=1&after=2",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown route",
+			method:     http.MethodGet,
+			path:       "/api/v1/nothing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodDelete,
+			path:       "/api/v1/snippets/1",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, response := serveAPI(t, handler, token, tt.method, tt.path, tt.body)
+
+			assertResponseCode(t, status, tt.wantStatus)
+
+			if response.Error == nil || response.Error.Status != tt.wantStatus || response.Error.Message == "" {
+				t.Fatalf("got error %+v, want status %d and a message", response.Error, tt.wantStatus)
+			}
+
+			if id := header.Get("X-Request-ID"); id == "" || response.Error.RequestID != id {
+				t.Errorf("got request ID %q in the error and %q in the header, want them equal", response.Error.RequestID, id)
+			}
+
+			for field, want := range tt.wantFields {
+				if got := response.Error.Fields[field]; got != want {
+					t.Errorf("got %s error %q, want %q", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIDatabaseErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{database.ErrTimeout, http.StatusGatewayTimeout},
+		{database.ErrCanceled, http.StatusServiceUnavailable},
+		{database.ErrGeneric, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			app := newAPITestApp(&failingStore{err: tt.err})
+			_, token := newAPIToken(t, app, "api@example.com", database.ScopeRead)
+			handler := app.NewServeMux()
+
+			for _, path := range []string{"/api/v1/snippets", "/api/v1/snippets/1"} {
+				status, _, response := serveAPI(t, handler, token, http.MethodGet, path, "")
+
+				assertResponseCode(t, status, tt.wantStatus)
+
+				if response.Error == nil || response.Error.Status != tt.wantStatus {
+					t.Errorf("got error %+v, want status %d", response.Error, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
@@ -4,61 +4,238 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/diff"
+	"github.com/andremfp/snippetbox/internal/session"
+	"github.com/andremfp/snippetbox/internal/syntax"
+	"github.com/andremfp/snippetbox/internal/templates"
 	"github.com/andremfp/snippetbox/internal/validator"
 	"github.com/go-playground/form/v4"
 	"github.com/julienschmidt/httprouter"
 )
 
 type Application struct {
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+	Logger        *slog.Logger
 	SnippetStore  database.Store
+	UserStore     database.UserStore
+	TokenStore    database.TokenStore
+	Sessions      *session.Manager
 	TemplateCache map[string]*template.Template
 	FormDecoder   *form.Decoder
+	Metrics       *Metrics
+	RateLimits    RateLimits
 }
 
+// authenticatedUserIDKey is the session key holding the id of the user who
+// is logged in.
+const authenticatedUserIDKey = "authenticatedUserID"
+
+// flashKey is the session key holding the messages queued for the next page.
+const flashKey = "flash"
+
+// newAPITokenKey is the session key holding a just-created API token until
+// the tokens page has shown it once.
+const newAPITokenKey = "newAPIToken"
+
+// snippetCreateForm backs both the create and the edit page, and the body of
+// a snippet created through the API. ID is only set when editing, and
+// decides where create.html posts the form.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	ID                  int    `form:"-" json:"-"`
+	Title               string `form:"title" json:"title"`
+	Content             string `form:"content" json:"content"`
+	Language            string `form:"language" json:"language"`
+	Expires             int    `form:"expires" json:"expires"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
+func (form *userSignupForm) validate() {
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	// bcrypt refuses passwords over 72 bytes, however few characters that is.
+	form.CheckField(len(form.Password) <= 72, "password", "This field must be at most 72 bytes long")
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (form *userLoginForm) validate() {
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+}
+
+// apiTokenForm creates an API token. Expires is in days, with 0 meaning the
+// token never expires.
+type apiTokenForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	Expires             int      `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+func (form *apiTokenForm) validate() {
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		form.CheckField(validator.PermittedValue(scope, database.ScopeRead, database.ScopeWrite), "scopes", "Scopes must be read or write")
+	}
+	form.CheckField(validator.PermittedValue(form.Expires, 0, 30, 90, 365), "expires", "This field must be 30, 90, 365 or never")
+}
+
+// HasScope lets tokens.html keep the scope boxes ticked when redisplaying
+// the form.
+func (form apiTokenForm) HasScope(scope string) bool {
+	return slices.Contains(form.Scopes, scope)
+}
+
+func (form *snippetCreateForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(form.Language == "" || syntax.Lookup(form.Language) != nil, "language", "This field must be a supported language")
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must be 1, 7 or 365")
+}
+
+// Listings show this many snippets unless ?limit= asks for another page
+// size, which is capped at maxPageSize.
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
 func (app *Application) HomeHandler(w http.ResponseWriter, r *http.Request) {
 
-	snippets, err := app.SnippetStore.Latest()
+	cursor, ok := pageCursor(r.URL.Query())
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	snippets, err := app.SnippetStore.Latest(r.Context(), lookahead(cursor))
 	if err != nil {
-		app.serverError(w, err)
+		app.databaseError(w, r, err)
 		return
 	}
 
 	data := app.newTemplateData(r)
-	data.Snippets = snippets
+	data.Snippets, data.Pagination = paginate(snippets, cursor, "/", url.Values{})
+
+	app.Render(w, r, http.StatusOK, "home.html", data)
+}
+
+func (app *Application) searchHandler(w http.ResponseWriter, r *http.Request) {
+
+	cursor, ok := pageCursor(r.URL.Query())
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+
+	data := app.newTemplateData(r)
+	data.Query = query
+
+	if len(database.SearchTerms(query)) > 0 {
+		snippets, err := app.SnippetStore.Search(r.Context(), query, lookahead(cursor))
+		if err != nil {
+			app.databaseError(w, r, err)
+			return
+		}
+
+		data.Snippets, data.Pagination = paginate(snippets, cursor, "/search", url.Values{"q": {query}})
+	}
 
-	app.Render(w, http.StatusOK, "home.html", data)
+	app.Render(w, r, http.StatusOK, "search.html", data)
 }
 
 func (app *Application) snippetViewHandler(w http.ResponseWriter, r *http.Request) {
 
-	params := httprouter.ParamsFromContext(r.Context())
+	id, ok := routeID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
 
-	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
+	var snippet *database.Snippet
+	var err error
+
+	// An old version can be viewed with ?revision=N
+	if r.URL.Query().Has("revision") {
+		revision, convErr := strconv.Atoi(r.URL.Query().Get("revision"))
+		if convErr != nil || revision < 1 {
+			app.notFound(w, r)
+			return
+		}
+
+		snippet, err = app.SnippetStore.GetRevision(r.Context(), id, revision)
+	} else {
+		snippet, err = app.SnippetStore.Get(r.Context(), id)
+	}
+
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
 		return
 	}
 
-	snippet, err := app.SnippetStore.Get(id)
+	data := app.newTemplateData(r)
+
+	data.Snippet = snippet
+	data.IsOwner = app.ownsSnippet(r, snippet)
+
+	app.Render(w, r, http.StatusOK, "view.html", data)
+
+}
+
+func (app *Application) snippetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := routeID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	snippet, err := app.SnippetStore.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
+	}
+
+	revisions, err := app.SnippetStore.Revisions(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, database.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.databaseError(w, r, err)
 		}
 		return
 	}
@@ -66,9 +243,80 @@ func (app *Application) snippetViewHandler(w http.ResponseWriter, r *http.Reques
 	data := app.newTemplateData(r)
 
 	data.Snippet = snippet
+	data.Revisions = revisions
+
+	app.Render(w, r, http.StatusOK, "history.html", data)
+}
+
+// snippetDiffHandler shows the changes between the ?from and ?to revisions.
+// Without ?to it compares against the current revision, and without ?from
+// against the revision just before ?to.
+func (app *Application) snippetDiffHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := routeID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var to *database.Snippet
+	var err error
 
-	app.Render(w, http.StatusOK, "view.html", data)
+	if query.Has("to") {
+		revision, convErr := strconv.Atoi(query.Get("to"))
+		if convErr != nil {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		to, err = app.SnippetStore.GetRevision(r.Context(), id, revision)
+	} else {
+		to, err = app.SnippetStore.Get(r.Context(), id)
+	}
+
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
+	}
+
+	fromRevision := to.Revision - 1
+	if query.Has("from") {
+		fromRevision, err = strconv.Atoi(query.Get("from"))
+		if err != nil {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	from, err := app.SnippetStore.GetRevision(r.Context(), id, fromRevision)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
+	}
+
+	// Revisions too far apart to diff still get a page saying so.
+	hunks, err := diff.Unified(from.Content, to.Content, 3)
 
+	data := app.newTemplateData(r)
+
+	data.Snippet = to
+	data.Diff = &templates.Diff{
+		From:     from,
+		To:       to,
+		Hunks:    hunks,
+		TooLarge: errors.Is(err, diff.ErrTooLarge),
+	}
+
+	app.Render(w, r, http.StatusOK, "diff.html", data)
 }
 
 func (app *Application) snippetCreateHandler(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +325,7 @@ func (app *Application) snippetCreateHandler(w http.ResponseWriter, r *http.Requ
 	data.Form = snippetCreateForm{
 		Expires: 365,
 	}
-	app.Render(w, http.StatusOK, "create.html", data)
+	app.Render(w, r, http.StatusOK, "create.html", data)
 }
 
 func (app *Application) snippetCreatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -85,26 +333,440 @@ func (app *Application) snippetCreatePostHandler(w http.ResponseWriter, r *http.
 
 	err := app.DecodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.formError(w, r, err)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must be 1, 7 or 365")
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusSeeOther, "create.html", data)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.SnippetStore.Insert(r.Context(), form.Title, form.Content, form.Language, form.Expires, userID)
+	if err != nil {
+		app.databaseError(w, r, err)
+		return
+	}
+
+	app.flash(r, "Snippet successfully created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *Application) snippetEditHandler(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	data.Form = snippetCreateForm{
+		ID:       snippet.ID,
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.Language,
+		Expires:  expiresOption(time.Until(snippet.Expires)),
+	}
+	app.Render(w, r, http.StatusOK, "create.html", data)
+}
+
+func (app *Application) snippetEditPostHandler(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	id := snippet.ID
+
+	var form snippetCreateForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.formError(w, r, err)
+		return
+	}
+
+	form.ID = id
+	form.validate()
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.Render(w, http.StatusSeeOther, "create.html", data)
+		app.Render(w, r, http.StatusSeeOther, "create.html", data)
 		return
 	}
 
-	id, err := app.SnippetStore.Insert(form.Title, form.Content, form.Expires)
+	err = app.SnippetStore.Update(r.Context(), id, form.Title, form.Content, form.Language, form.Expires)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
 	}
 
+	app.flash(r, "Snippet successfully updated!")
+
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
+
+func (app *Application) snippetDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.SnippetStore.Delete(r.Context(), snippet.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
+	}
+
+	app.flash(r, "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// ownSnippet returns the live snippet named by the route if the logged in
+// user wrote it, and otherwise answers with 404 or 403 itself. Snippets from
+// before user accounts have no author, so nobody can change them.
+func (app *Application) ownSnippet(w http.ResponseWriter, r *http.Request) (*database.Snippet, bool) {
+	id, ok := routeID(r)
+	if !ok {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.SnippetStore.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !app.ownsSnippet(r, snippet) {
+		app.clientError(w, r, http.StatusForbidden)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// routeID reads the :id route parameter, reporting false unless it is a
+// positive integer.
+func routeID(r *http.Request) (int, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (app *Application) userSignupHandler(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.Render(w, r, http.StatusOK, "signup.html", data)
+}
+
+func (app *Application) userSignupPostHandler(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.formError(w, r, err)
+		return
+	}
+
+	form.validate()
+
+	if form.Valid() {
+		_, err = app.UserStore.Insert(r.Context(), form.Name, form.Email, form.Password)
+		if err != nil {
+			if !errors.Is(err, database.ErrDuplicateEmail) {
+				app.databaseError(w, r, err)
+				return
+			}
+			form.AddFieldError("email", "Email address is already in use")
+		}
+	}
+
+	if !form.Valid() {
+		// Never send the password back to the browser.
+		form.Password = ""
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusSeeOther, "signup.html", data)
+		return
+	}
+
+	app.flash(r, "Your signup was successful. Please log in.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *Application) userLoginHandler(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.Render(w, r, http.StatusOK, "login.html", data)
+}
+
+func (app *Application) userLoginPostHandler(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.formError(w, r, err)
+		return
+	}
+
+	form.validate()
+
+	var id int
+	if form.Valid() {
+		id, err = app.UserStore.Authenticate(r.Context(), form.Email, form.Password)
+		if err != nil {
+			if !errors.Is(err, database.ErrInvalidCredentials) {
+				app.databaseError(w, r, err)
+				return
+			}
+			form.AddNonFieldError("Email or password is incorrect")
+		}
+	}
+
+	if !form.Valid() {
+		form.Password = ""
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusSeeOther, "login.html", data)
+		return
+	}
+
+	// A new token on login stops a session fixation attack.
+	err = app.Sessions.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Sessions.Put(r.Context(), authenticatedUserIDKey, id)
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+func (app *Application) userLogoutPostHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.Sessions.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Sessions.Remove(r.Context(), authenticatedUserIDKey)
+
+	app.flash(r, "You've been logged out successfully!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// tokensHandler lists the user's API tokens, showing a token just created
+// by tokenCreatePostHandler this once.
+func (app *Application) tokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.TokenStore.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.databaseError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = app.Sessions.PopString(r.Context(), newAPITokenKey)
+	data.Form = apiTokenForm{
+		Scopes:  []string{database.ScopeRead},
+		Expires: 90,
+	}
+
+	app.Render(w, r, http.StatusOK, "tokens.html", data)
+}
+
+func (app *Application) tokenCreatePostHandler(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.formError(w, r, err)
+		return
+	}
+
+	form.validate()
+
+	userID := app.authenticatedUserID(r)
+
+	if !form.Valid() {
+		tokens, err := app.TokenStore.ForUser(r.Context(), userID)
+		if err != nil {
+			app.databaseError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Tokens = tokens
+		data.Form = form
+		app.Render(w, r, http.StatusSeeOther, "tokens.html", data)
+		return
+	}
+
+	var expires time.Time
+	if form.Expires > 0 {
+		expires = time.Now().AddDate(0, 0, form.Expires)
+	}
+
+	plaintext, err := app.TokenStore.Insert(r.Context(), userID, form.Name, form.Scopes, expires)
+	if err != nil {
+		app.databaseError(w, r, err)
+		return
+	}
+
+	// The plaintext goes through the session so that it survives the
+	// redirect but is gone once the tokens page has shown it.
+	app.Sessions.Put(r.Context(), newAPITokenKey, plaintext)
+
+	app.flash(r, "API token created.")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *Application) tokenDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := routeID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	err := app.TokenStore.Delete(r.Context(), app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.databaseError(w, r, err)
+		}
+		return
+	}
+
+	app.flash(r, "API token revoked.")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+// pageCursor reads ?before=, ?after= and ?limit= into a cursor. Only one of
+// before and after may be given, and an oversized limit is cut down to
+// maxPageSize rather than refused.
+func pageCursor(query url.Values) (database.Cursor, bool) {
+	cursor := database.Cursor{Limit: defaultPageSize}
+
+	for key, dst := range map[string]*int{"before": &cursor.Before, "after": &cursor.After, "limit": &cursor.Limit} {
+		if !query.Has(key) {
+			continue
+		}
+
+		value, err := strconv.Atoi(query.Get(key))
+		if err != nil || value < 1 {
+			return database.Cursor{}, false
+		}
+
+		*dst = value
+	}
+
+	if cursor.Before > 0 && cursor.After > 0 {
+		return database.Cursor{}, false
+	}
+
+	cursor.Limit = min(cursor.Limit, maxPageSize)
+
+	return cursor, true
+}
+
+// lookahead asks for one snippet more than the page holds, so that paginate
+// can tell whether there is another page in the direction being read.
+func lookahead(cursor database.Cursor) database.Cursor {
+	cursor.Limit++
+	return cursor
+}
+
+// paginate trims snippets fetched with lookahead(cursor) to the page and
+// links it to its neighbours at path, carrying params along.
+func paginate(snippets []*database.Snippet, cursor database.Cursor, path string, params url.Values) ([]*database.Snippet, *templates.Pagination) {
+	more := len(snippets) > cursor.Limit
+	newer, older := cursor.Before > 0, more
+
+	if cursor.After > 0 {
+		newer, older = more, true
+		if more {
+			snippets = snippets[1:]
+		}
+	} else if more {
+		snippets = snippets[:cursor.Limit]
+	}
+
+	if len(snippets) == 0 || !(newer || older) {
+		return snippets, nil
+	}
+
+	pagination := &templates.Pagination{}
+
+	if newer {
+		pagination.Newer = pageURL(path, params, "after", snippets[0].ID, cursor.Limit)
+	}
+
+	if older {
+		pagination.Older = pageURL(path, params, "before", snippets[len(snippets)-1].ID, cursor.Limit)
+	}
+
+	return snippets, pagination
+}
+
+// pageURL links to path one page on from id, keeping the page size when it
+// is not the default.
+func pageURL(path string, params url.Values, key string, id int, limit int) string {
+	query := url.Values{key: {strconv.Itoa(id)}}
+	for name, values := range params {
+		query[name] = values
+	}
+
+	if limit != defaultPageSize {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	return path + "?" + query.Encode()
+}
+
+// expiresOption picks the form's expiry choice closest to the time a snippet
+// has left, so editing does not silently stretch a one-day snippet to a year.
+func expiresOption(remaining time.Duration) int {
+	switch {
+	case remaining <= 24*time.Hour:
+		return 1
+	case remaining <= 7*24*time.Hour:
+		return 7
+	default:
+		return 365
+	}
+}
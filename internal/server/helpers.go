@@ -2,37 +2,83 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/middleware"
 	"github.com/andremfp/snippetbox/internal/templates"
 	"github.com/go-playground/form/v4"
 )
 
-func (app *Application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Output(2, trace)
+// serverError logs err with the request it failed and a stack trace, and
+// answers 500.
+func (app *Application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logServerError(r, err)
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	app.clientError(w, r, http.StatusInternalServerError)
 }
 
-func (app *Application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+// databaseError answers a failed Store call. A query that ran out of time is
+// a 504 and one abandoned because the request was canceled is a 503, so they
+// can be told apart from genuine failures.
+func (app *Application) databaseError(w http.ResponseWriter, r *http.Request, err error) {
+	var status int
+
+	switch {
+	case errors.Is(err, database.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, database.ErrCanceled):
+		status = http.StatusServiceUnavailable
+	default:
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Logger.Warn("database unavailable", requestAttrs(r, err, slog.Int("status", status))...)
+
+	app.clientError(w, r, status)
+}
+
+func (app *Application) logServerError(r *http.Request, err error) {
+	app.Logger.Error("internal server error", requestAttrs(r, err, slog.String("trace", string(debug.Stack())))...)
 }
 
-func (app *Application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+// requestAttrs returns the attributes every log record about a request
+// starts with, followed by err and then extra.
+func requestAttrs(r *http.Request, err error, extra ...any) []any {
+	attrs := []any{
+		slog.String("request_id", middleware.RequestID(r)),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Any("error", err),
+	}
+
+	return append(attrs, extra...)
 }
 
-func (app *Application) Render(w http.ResponseWriter, status int, page string, data *templates.TemplateData) {
+// clientError answers with a plain text page naming the status and the
+// request ID.
+func (app *Application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	middleware.Error(w, r, status)
+}
+
+func (app *Application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+func (app *Application) Render(w http.ResponseWriter, r *http.Request, status int, page string, data *templates.TemplateData) {
 
 	ts, ok := app.TemplateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -41,11 +87,13 @@ func (app *Application) Render(w http.ResponseWriter, status int, page string, d
 	// and then return.
 	buf := new(bytes.Buffer)
 
+	start := time.Now()
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	app.Metrics.observeRender(page, time.Since(start))
 
 	w.WriteHeader(status)
 
@@ -54,23 +102,124 @@ func (app *Application) Render(w http.ResponseWriter, status int, page string, d
 
 func (app *Application) newTemplateData(r *http.Request) *templates.TemplateData {
 	return &templates.TemplateData{
-		CurrentYear: time.Now().Year(),
+		CurrentYear:     time.Now().Year(),
+		IsAuthenticated: app.isAuthenticated(r),
+		Flash:           app.popFlash(r),
+		CSRFToken:       middleware.CSRFToken(r),
 	}
 }
 
-func (app *Application) logRequest(next http.Handler) http.Handler {
+// flash queues a message to show once on the next page rendered for this
+// session, which is usually the one the handler redirects to.
+func (app *Application) flash(r *http.Request, message string) {
+	messages, _ := app.Sessions.Get(r.Context(), flashKey).([]string)
+	app.Sessions.Put(r.Context(), flashKey, append(messages, message))
+}
+
+// popFlash returns the queued flash messages and clears them.
+func (app *Application) popFlash(r *http.Request) []string {
+	messages, _ := app.Sessions.Pop(r.Context(), flashKey).([]string)
+	return messages
+}
+
+type contextKey string
+
+const (
+	isAuthenticatedContextKey = contextKey("isAuthenticated")
+	apiTokenContextKey        = contextKey("apiToken")
+	routeContextKey           = contextKey("route")
+)
+
+// isAuthenticated reports whether authenticate found a logged in user that
+// still exists.
+func (app *Application) isAuthenticated(r *http.Request) bool {
+	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	return ok && isAuthenticated
+}
+
+// authenticatedUserID returns the id of the logged in user, or 0 if there is
+// none.
+func (app *Application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	return app.Sessions.GetInt(r.Context(), authenticatedUserIDKey)
+}
+
+// ownsSnippet reports whether the logged in user wrote snippet. Snippets with
+// no author belong to nobody.
+func (app *Application) ownsSnippet(r *http.Request, snippet *database.Snippet) bool {
+	return snippet.UserID != 0 && snippet.UserID == app.authenticatedUserID(r)
+}
+
+// authenticate marks the request as authenticated when the session holds the
+// id of a user who still exists.
+func (app *Application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.InfoLog.Printf("%s - %s", r.Method, r.URL.String())
+		id := app.Sessions.GetInt(r.Context(), authenticatedUserIDKey)
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, err := app.UserStore.Get(r.Context(), id)
+		if err != nil {
+			if !errors.Is(err, database.ErrNoRecord) {
+				app.databaseError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireAuthentication sends anyone not logged in to the login page.
+func (app *Application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Pages behind a login must not be kept in shared caches.
+		w.Header().Add("Cache-Control", "no-store")
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// logRequest writes one access log record per request once it has been
+// answered.
+func (app *Application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		app.Logger.Info("request",
+			slog.String("request_id", middleware.RequestID(r)),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status),
+			slog.Int64("bytes", rec.Bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
 func (app *Application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -98,3 +247,15 @@ func (app *Application) DecodePostForm(r *http.Request, dst any) error {
 
 	return nil
 }
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
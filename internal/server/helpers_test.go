@@ -1,6 +1,11 @@
 package server_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -8,6 +13,8 @@ import (
 	"time"
 
 	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/health"
+	"github.com/andremfp/snippetbox/internal/metrics"
 	"github.com/andremfp/snippetbox/internal/server"
 	"github.com/andremfp/snippetbox/internal/templates"
 	approvals "github.com/approvals/go-approval-tests"
@@ -16,18 +23,20 @@ import (
 
 var testSnippets = []*database.Snippet{
 	{
-		ID:      1,
-		Title:   "title1",
-		Content: "content1",
-		Created: time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
-		Expires: time.Date(2024, time.March, 21, 17, 17, 51, 0, time.UTC),
+		ID:       1,
+		Title:    "title1",
+		Content:  "content1",
+		Created:  time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
+		Expires:  time.Date(2024, time.March, 21, 17, 17, 51, 0, time.UTC),
+		Revision: 1,
 	},
 	{
-		ID:      2,
-		Title:   "title2",
-		Content: "content2",
-		Created: time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
-		Expires: time.Date(2024, time.March, 22, 17, 17, 51, 0, time.UTC),
+		ID:       2,
+		Title:    "title2",
+		Content:  "content2",
+		Created:  time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
+		Expires:  time.Date(2024, time.March, 22, 17, 17, 51, 0, time.UTC),
+		Revision: 1,
 	},
 }
 
@@ -49,12 +58,62 @@ func TestRender(t *testing.T) {
 		{
 			name:         "home page is rendered successfully and valid",
 			templateName: "home.html",
-			data:         &templates.TemplateData{CurrentYear: time.Now().Year(), Snippets: testSnippets},
+			data:         &templates.TemplateData{CurrentYear: 2024, Snippets: testSnippets},
 		},
 		{
 			name:         "view page is rendered successfully and valid",
 			templateName: "view.html",
-			data:         &templates.TemplateData{CurrentYear: time.Now().Year(), Snippet: testSnippets[0]},
+			data:         &templates.TemplateData{CurrentYear: 2024, Snippet: testSnippets[0], IsAuthenticated: true, IsOwner: true, CSRFToken: "test-csrf-token"},
+		},
+		{
+			name:         "home page is rendered with links to the next and previous pages",
+			templateName: "home.html",
+			data: &templates.TemplateData{
+				CurrentYear: 2024,
+				Snippets:    testSnippets,
+				Pagination:  &templates.Pagination{Newer: "/?after=2&limit=2", Older: "/?before=1&limit=2"},
+			},
+		},
+		{
+			name:         "search page highlights matches and escapes everything else",
+			templateName: "search.html",
+			data: &templates.TemplateData{
+				CurrentYear: 2024,
+				Query:       "<b>con",
+				Snippets: []*database.Snippet{
+					{
+						ID:      3,
+						Title:   "<b>Bold</b> contents",
+						Content: "first line\n<script>alert('content')</script>\nlast line",
+						Created: time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			name:         "home page shows every flash message",
+			templateName: "home.html",
+			data: &templates.TemplateData{
+				CurrentYear: 2024,
+				Snippets:    testSnippets,
+				Flash:       []string{"Snippet successfully deleted!", "<b>escaped</b>"},
+			},
+		},
+		{
+			name:         "view page highlights code and escapes everything else",
+			templateName: "view.html",
+			data: &templates.TemplateData{
+				CurrentYear: 2024,
+				Snippet: &database.Snippet{
+					ID:       4,
+					Title:    "Hello",
+					Content:  "// Say hi.\nfunc hi() string {\n\treturn \"<script>alert('hi')</script>\"\n}\n",
+					Language: "go",
+					Created:  time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
+					Expires:  time.Date(2024, time.March, 22, 16, 17, 51, 0, time.UTC),
+					Revision: 1,
+				},
+			},
 		},
 	}
 
@@ -62,8 +121,9 @@ func TestRender(t *testing.T) {
 
 		t.Run("home page is rendered successfully and valid", func(t *testing.T) {
 			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-			testApp.Render(w, http.StatusOK, tt.templateName, tt.data)
+			testApp.Render(w, r, http.StatusOK, tt.templateName, tt.data)
 
 			approvals.VerifyString(t, w.Body.String())
 
@@ -72,6 +132,103 @@ func TestRender(t *testing.T) {
 	}
 }
 
+func TestServerErrorLog(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := &server.Application{
+		Logger:        slog.New(slog.NewJSONHandler(&logs, nil)),
+		TemplateCache: map[string]*template.Template{},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/snippet/view/1?x=y", nil)
+
+	app.Render(w, r, http.StatusOK, "missing.html", &templates.TemplateData{})
+
+	assertResponseCode(t, w.Code, http.StatusInternalServerError)
+
+	var record struct {
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Error  string `json:"error"`
+		Trace  string `json:"trace"`
+	}
+
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("could not decode log %q, %v", logs.String(), err)
+	}
+
+	if record.Level != "ERROR" || record.Method != http.MethodGet || record.Path != "/snippet/view/1" {
+		t.Errorf("got record %+v, want an ERROR for GET /snippet/view/1", record)
+	}
+
+	if want := "the template missing.html does not exist"; record.Error != want {
+		t.Errorf("got error %q, want %q", record.Error, want)
+	}
+
+	if !strings.Contains(record.Trace, "runtime/debug.Stack") || strings.Contains(record.Msg, "\n") {
+		t.Errorf("got message %q and trace %q, want the stack in the trace only", record.Msg, record.Trace)
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := newAPITestApp(&failingStore{err: database.ErrGeneric})
+	app.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := app.NewServeMux()
+
+	r := httptest.NewRequest(http.MethodGet, "/?after=1", nil)
+	r.Header.Set("X-Request-ID", "trace-me")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assertResponseCode(t, w.Code, http.StatusInternalServerError)
+
+	if got, want := w.Body.String(), "Internal Server Error\nRequest ID: trace-me\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+
+	type record struct {
+		Msg        string `json:"msg"`
+		RequestID  string `json:"request_id"`
+		Method     string `json:"method"`
+		Path       string `json:"path"`
+		Status     int    `json:"status"`
+		Bytes      int    `json:"bytes"`
+		Duration   *int64 `json:"duration"`
+		RemoteAddr string `json:"remote_addr"`
+	}
+
+	var records []record
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("could not decode log, %v", err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 || records[0].Msg != "internal server error" || records[1].Msg != "request" {
+		t.Fatalf("got records %+v, want the error and then the access log", records)
+	}
+
+	for _, rec := range records {
+		if rec.RequestID != "trace-me" || rec.Method != http.MethodGet || rec.Path != "/" {
+			t.Errorf("got record %+v, want request trace-me for GET /", rec)
+		}
+	}
+
+	access := records[1]
+	if access.Status != http.StatusInternalServerError || access.Bytes != w.Body.Len() || access.Duration == nil || access.RemoteAddr == "" {
+		t.Errorf("got access log %+v, want status 500, %d bytes, a duration and the remote address", access, w.Body.Len())
+	}
+}
+
 func TestDecodePostForm(t *testing.T) {
 	type testDestinationForm struct {
 		Key1 string `form:"key1"`
@@ -148,3 +305,43 @@ func TestDecodePostForm(t *testing.T) {
 		})
 	}
 }
+
+func TestProbes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	checker := &health.Checker{Timeout: time.Second}
+	admin := server.NewAdminServer("", logger, metrics.NewRegistry(logger), checker, server.Limits{}).Handler
+	public := newAPITestApp(database.NewMemoryStore()).NewServeMux()
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		path       string
+		shutDown   bool
+		wantStatus int
+		wantBody   string
+	}{
+		{"liveness", admin, "/healthz", false, http.StatusOK, `"status": "ok"`},
+		{"readiness", admin, "/readyz", false, http.StatusOK, `"status": "ok"`},
+		{"no liveness on the public listener", public, "/healthz", false, http.StatusNotFound, "Not Found"},
+		{"no readiness on the public listener", public, "/readyz", false, http.StatusNotFound, "Not Found"},
+		{"readiness during shutdown", admin, "/readyz", true, http.StatusServiceUnavailable, `"status": "failing"`},
+		{"liveness during shutdown", admin, "/healthz", true, http.StatusOK, `"status": "ok"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.shutDown {
+				checker.ShutDown()
+			}
+
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assertResponseCode(t, w.Code, tt.wantStatus)
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("got body %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
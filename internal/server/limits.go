@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/justinas/alice"
+)
+
+// Request body caps. A snippet form carries a whole paste, every other form
+// a few short fields.
+const (
+	maxFormBytes    = 16 << 10
+	maxSnippetBytes = 1 << 20
+)
+
+// Limits bounds how long a client may take over each part of a request and
+// how large its headers may be. A zero field means no limit.
+type Limits struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
+func (l Limits) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = l.ReadHeaderTimeout
+	srv.ReadTimeout = l.ReadTimeout
+	srv.WriteTimeout = l.WriteTimeout
+	srv.IdleTimeout = l.IdleTimeout
+	srv.MaxHeaderBytes = l.MaxHeaderBytes
+}
+
+// limitBody returns middleware that caps request bodies at n bytes. A body
+// declared larger is refused with 413 straight away, and one that only turns
+// out larger fails to read with *http.MaxBytesError.
+func (app *Application) limitBody(n int64) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				app.bodyTooLarge(w, r, n)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *Application) bodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		app.apiError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", limit), nil)
+		return
+	}
+
+	app.clientError(w, r, http.StatusRequestEntityTooLarge)
+}
+
+// formError answers a request whose form DecodePostForm could not decode.
+func (app *Application) formError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		app.clientError(w, r, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	app.clientError(w, r, http.StatusBadRequest)
+}
@@ -0,0 +1,222 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/templates"
+)
+
+func TestLimits(t *testing.T) {
+	limits := server.Limits{
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		ReadTimeout:       time.Second,
+		WriteTimeout:      2 * time.Second,
+		IdleTimeout:       100 * time.Millisecond,
+		MaxHeaderBytes:    1 << 10,
+	}
+
+	t.Run("the webserver is built with the limits", func(t *testing.T) {
+		srv := server.NewWebserver(":4000", testApp.Logger, newAPITestApp(database.NewMemoryStore()), limits)
+
+		got := server.Limits{
+			ReadHeaderTimeout: srv.ReadHeaderTimeout,
+			ReadTimeout:       srv.ReadTimeout,
+			WriteTimeout:      srv.WriteTimeout,
+			IdleTimeout:       srv.IdleTimeout,
+			MaxHeaderBytes:    srv.MaxHeaderBytes,
+		}
+
+		if got != limits {
+			t.Errorf("got limits %+v, want %+v", got, limits)
+		}
+	})
+
+	// The redirect server answers at once, so it shows the connection
+	// limits without a handler getting in the way.
+	srv := server.NewRedirectServer("127.0.0.1:0", ":4000", slog.New(slog.NewTextHandler(io.Discard, nil)), limits)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx, srv, ln, time.Second)
+
+	tests := []struct {
+		name    string
+		request string
+		// wantStatus is the status line expected before the connection is
+		// closed, or empty when it should be closed without a response.
+		wantStatus string
+	}{
+		{
+			name:    "slow headers are cut off",
+			request: "GET / HTTP/1.1\r\nHost: localhost\r\n",
+		},
+		{
+			// The server allows 4KB of slack over MaxHeaderBytes.
+			name:       "oversized headers get 431",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\nCookie: " + strings.Repeat("x", 8<<10) + "\r\n\r\n",
+			wantStatus: "HTTP/1.1 431 Request Header Fields Too Large",
+		},
+		{
+			name:       "idle connections are closed",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantStatus: "HTTP/1.1 308 Permanent Redirect",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("could not dial, %v", err)
+			}
+			defer conn.Close()
+
+			// Well past every limit, so a connection still open by then was
+			// not closed by the server.
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+			if _, err := io.WriteString(conn, tt.request); err != nil {
+				t.Fatalf("could not write request, %v", err)
+			}
+
+			reader := bufio.NewReader(conn)
+
+			if tt.wantStatus != "" {
+				resp, err := http.ReadResponse(reader, nil)
+				if err != nil {
+					t.Fatalf("could not read response, %v", err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+
+				if got := resp.Proto + " " + resp.Status; got != tt.wantStatus {
+					t.Errorf("got %q, want %q", got, tt.wantStatus)
+				}
+			}
+
+			if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+				t.Errorf("got error %v, want the server to close the connection", err)
+			}
+		})
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	app := newAPITestApp(database.NewMemoryStore())
+
+	templateCache, err := templates.NewTemplateCache()
+	if err != nil {
+		t.Fatalf("could not create template cache, %v", err)
+	}
+	app.TemplateCache = templateCache
+
+	testServer := httptest.NewServer(app.NewServeMux())
+	defer testServer.Close()
+
+	client := testServer.Client()
+	client.Jar, _ = cookiejar.New(nil)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	csrfToken := fetchCSRFToken(t, client, fmt.Sprintf("%s/user/login", testServer.URL))
+
+	tests := []struct {
+		name    string
+		path    string
+		size    int
+		chunked bool
+		// wantStatus is 303 for forms under their cap, as the requests are
+		// turned away to the login page only after the body is read.
+		wantStatus int
+	}{
+		{
+			name:       "form under the cap",
+			path:       "/user/login",
+			size:       1 << 10,
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "form over the cap",
+			path:       "/user/login",
+			size:       32 << 10,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "form over the cap without a length",
+			path:       "/user/login",
+			size:       32 << 10,
+			chunked:    true,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "snippet over the form cap",
+			path:       "/snippet/create",
+			size:       512 << 10,
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "snippet over its own cap",
+			path:       "/snippet/create",
+			size:       2 << 20,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "snippet over its own cap without a length",
+			path:       "/snippet/create",
+			size:       2 << 20,
+			chunked:    true,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				"csrf_token": {csrfToken},
+				"email":      {"alice@example.com"},
+				"content":    {strings.Repeat("x", tt.size)},
+			}
+
+			var body io.Reader = strings.NewReader(form.Encode())
+			if tt.chunked {
+				// Hiding the reader's type hides its length too.
+				body = io.MultiReader(body)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, testServer.URL+tt.path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			response, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+			response.Body.Close()
+
+			assertResponseCode(t, response.StatusCode, tt.wantStatus)
+		})
+	}
+}
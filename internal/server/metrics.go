@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/metrics"
+	"github.com/andremfp/snippetbox/internal/middleware"
+	"github.com/julienschmidt/httprouter"
+)
+
+// unmatchedRoute labels requests no route matched, so probes for random
+// paths cannot create a series each.
+const unmatchedRoute = "unmatched"
+
+// Metrics records how the application is doing. A nil *Metrics records
+// nothing, which is what tests get.
+type Metrics struct {
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	renderDuration  *metrics.Histogram
+	storeDuration   *metrics.Histogram
+}
+
+// NewMetrics registers the application's metrics on reg.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: reg.Counter("snippetbox_http_requests_total",
+			"HTTP requests answered, by route pattern.", "method", "route", "status"),
+		requestDuration: reg.Histogram("snippetbox_http_request_duration_seconds",
+			"Time taken to answer HTTP requests, by route pattern.", metrics.DefaultBuckets, "method", "route"),
+		renderDuration: reg.Histogram("snippetbox_template_render_duration_seconds",
+			"Time taken to render page templates.", []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}, "page"),
+		storeDuration: reg.Histogram("snippetbox_store_operation_duration_seconds",
+			"Time taken by store operations, by how they ended.", metrics.DefaultBuckets, "store", "operation", "outcome"),
+	}
+}
+
+// ObserveStore is a database.Observer.
+func (m *Metrics) ObserveStore(store string, operation string, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.storeDuration.Observe(took.Seconds(), store, operation, storeOutcome(err))
+}
+
+func (m *Metrics) observeRequest(method string, route string, status int, took time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.requests.Inc(method, route, strconv.Itoa(status))
+	m.requestDuration.Observe(took.Seconds(), method, route)
+}
+
+func (m *Metrics) observeRender(page string, took time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.renderDuration.Observe(took.Seconds(), page)
+}
+
+// storeOutcome sorts a store error into a few kinds. Errors that are an
+// answer, like a missing record, are "rejected" rather than "error", so the
+// latter only counts real failures.
+func storeOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, database.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, database.ErrCanceled):
+		return "canceled"
+	case errors.Is(err, database.ErrNoRecord), errors.Is(err, database.ErrInvalidCredentials),
+		errors.Is(err, database.ErrDuplicateEmail), errors.Is(err, database.ErrInvalidToken):
+		return "rejected"
+	default:
+		return "error"
+	}
+}
+
+// measureRequest counts and times every request by the pattern of the route
+// that served it.
+func (app *Application) measureRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := unmatchedRoute
+		rec := middleware.NewStatusRecorder(w)
+
+		ctx := context.WithValue(r.Context(), routeContextKey, &route)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		app.Metrics.observeRequest(metricMethod(r.Method), route, rec.Status, time.Since(start))
+	})
+}
+
+// metricMethod keeps the method label to the standard methods.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// patternRouter is an httprouter.Router that tells measureRequest the
+// pattern a request matched, which httprouter does not expose itself.
+type patternRouter struct {
+	*httprouter.Router
+}
+
+func (router patternRouter) Handler(method, path string, handler http.Handler) {
+	router.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+			*route = path
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
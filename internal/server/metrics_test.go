@@ -0,0 +1,114 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/metrics"
+	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/session"
+	"github.com/andremfp/snippetbox/internal/templates"
+	"github.com/go-playground/form/v4"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry(testApp.Logger)
+	appMetrics := server.NewMetrics(registry)
+
+	store := database.InstrumentStore(database.NewMemoryStore(), appMetrics.ObserveStore)
+	id, _ := store.Insert(context.Background(), "title", "content", "", 7, 0)
+
+	templateCache, err := templates.NewTemplateCache()
+	if err != nil {
+		t.Fatalf("failed to create template cache: %v", err)
+	}
+
+	app := &server.Application{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SnippetStore:  store,
+		UserStore:     database.NewMemoryUserStore(),
+		Sessions:      session.New(session.NewMemoryStore(0)),
+		TemplateCache: templateCache,
+		FormDecoder:   form.NewDecoder(),
+		Metrics:       appMetrics,
+	}
+
+	handler := app.NewServeMux()
+
+	for _, path := range []string{fmt.Sprintf("/snippet/view/%d", id), "/snippet/view/999", "/no/such/page", "/snippet/view/1/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	admin := httptest.NewServer(server.NewAdminServer("", app.Logger, registry, nil, server.Limits{}).Handler)
+	defer admin.Close()
+
+	response, err := http.Get(admin.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("could not make request to admin server, %v", err)
+	}
+	defer response.Body.Close()
+
+	assertResponseCode(t, response.StatusCode, http.StatusOK)
+
+	body, _ := io.ReadAll(response.Body)
+
+	want := []string{
+		`snippetbox_http_requests_total{method="GET",route="/snippet/view/:id",status="200"} 1`,
+		`snippetbox_http_requests_total{method="GET",route="/snippet/view/:id",status="404"} 1`,
+		`snippetbox_http_requests_total{method="GET",route="unmatched",status="404"} 2`,
+		`snippetbox_http_requests_total{method="OTHER",route="unmatched",status="405"} 1`,
+		`snippetbox_http_request_duration_seconds_count{method="GET",route="/snippet/view/:id"} 2`,
+		`snippetbox_template_render_duration_seconds_count{page="view.html"} 1`,
+		`snippetbox_store_operation_duration_seconds_count{store="snippets",operation="get",outcome="ok"} 1`,
+		`snippetbox_store_operation_duration_seconds_count{store="snippets",operation="get",outcome="rejected"} 1`,
+		`snippetbox_store_operation_duration_seconds_count{store="snippets",operation="insert",outcome="ok"} 1`,
+	}
+
+	for _, line := range want {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("got metrics\n%s\nwant a line %q", body, line)
+		}
+	}
+
+	if strings.Contains(string(body), "/no/such/page") {
+		t.Errorf("got the raw path of an unmatched request in the metrics")
+	}
+}
+
+func TestMetricsStoreOutcomes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{database.ErrNoRecord, "rejected"},
+		{database.ErrInvalidToken, "rejected"},
+		{fmt.Errorf("%w: %w", database.ErrTimeout, context.DeadlineExceeded), "timeout"},
+		{database.ErrCanceled, "canceled"},
+		{database.ErrGeneric, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			registry := metrics.NewRegistry(testApp.Logger)
+			server.NewMetrics(registry).ObserveStore("users", "get", time.Millisecond, tt.err)
+
+			w := httptest.NewRecorder()
+			registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			want := fmt.Sprintf(`snippetbox_store_operation_duration_seconds_count{store="users",operation="get",outcome="%s"} 1`, tt.want)
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("got metrics\n%s\nwant a line %q", w.Body.String(), want)
+			}
+		})
+	}
+}
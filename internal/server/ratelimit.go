@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/middleware"
+	"github.com/andremfp/snippetbox/internal/ratelimit"
+	"github.com/justinas/alice"
+)
+
+// RateLimits are the budgets of each group of routes. A nil Store turns rate
+// limiting off, and so does an unlimited budget for its group.
+type RateLimits struct {
+	Store ratelimit.Store
+	// Auth limits signup and login attempts, and failed API authentication,
+	// by client IP.
+	Auth ratelimit.Budget
+	// Snippets limits creating and editing snippets by user, whether through
+	// the site or the API.
+	Snippets ratelimit.Budget
+	// API limits every API call by token.
+	API ratelimit.Budget
+}
+
+// rateLimit returns middleware that spends a token from the bucket key picks
+// for the request within group, answering 429 once budget is spent.
+func (app *Application) rateLimit(group string, budget ratelimit.Budget, key func(*http.Request) string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		if app.RateLimits.Store == nil || budget.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := app.RateLimits.Store.Take(r.Context(), group+":"+key(r), budget)
+			if err != nil {
+				// A shared store being down should not take the site down
+				// with it, so the request goes through unlimited.
+				app.Logger.Warn("rate limiter unavailable", requestAttrs(r, err)...)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", budget.Limit, ceilSeconds(budget.Period)))
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				app.tooManyRequests(w, r, result.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitFailures returns middleware that counts only the requests next
+// answers with status against budget, in the bucket key picks. The token is
+// taken before next runs and refunded when the request did not fail, so
+// parallel requests cannot all slip in before the first failure lands.
+func (app *Application) limitFailures(group string, budget ratelimit.Budget, status int, key func(*http.Request) string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		if app.RateLimits.Store == nil || budget.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bucket := group + ":" + key(r)
+
+			result, err := app.RateLimits.Store.Take(r.Context(), bucket, budget)
+			if err != nil {
+				app.Logger.Warn("rate limiter unavailable", requestAttrs(r, err)...)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				app.tooManyRequests(w, r, result.RetryAfter)
+				return
+			}
+
+			rec := middleware.NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			if rec.Status != status {
+				if err := app.RateLimits.Store.Refund(r.Context(), bucket, budget); err != nil {
+					app.Logger.Warn("rate limiter unavailable", requestAttrs(r, err)...)
+				}
+			}
+		})
+	}
+}
+
+func (app *Application) tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		app.apiError(w, r, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded, retry in %s seconds", ceilSeconds(retryAfter)), nil)
+		return
+	}
+
+	app.clientError(w, r, http.StatusTooManyRequests)
+}
+
+// clientIP keys a request by the address it came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// userKey keys a request by the user behind it, whether logged in or using
+// an API token, falling back to the client IP.
+func (app *Application) userKey(r *http.Request) string {
+	if token, ok := r.Context().Value(apiTokenContextKey).(*database.Token); ok {
+		return "user:" + strconv.Itoa(token.UserID)
+	}
+
+	if id := app.authenticatedUserID(r); id != 0 {
+		return "user:" + strconv.Itoa(id)
+	}
+
+	return clientIP(r)
+}
+
+// tokenKey keys an API request by its token, which authenticateAPI must
+// have checked.
+func (app *Application) tokenKey(r *http.Request) string {
+	return "token:" + strconv.Itoa(app.apiToken(r).ID)
+}
+
+// ceilSeconds formats d as whole seconds, rounded up so a client waiting
+// that long is never early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
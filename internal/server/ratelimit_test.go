@@ -0,0 +1,251 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/ratelimit"
+	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/templates"
+)
+
+// failingLimiter is a ratelimit.Store that is always down.
+type failingLimiter struct{}
+
+func (failingLimiter) Take(ctx context.Context, key string, budget ratelimit.Budget) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("limiter unreachable")
+}
+
+func (failingLimiter) Refund(ctx context.Context, key string, budget ratelimit.Budget) error {
+	return errors.New("limiter unreachable")
+}
+
+// slowTokenStore counts the tokens it is asked to authenticate, and takes a
+// while over each so requests sent together overlap.
+type slowTokenStore struct {
+	database.TokenStore
+	calls atomic.Int32
+}
+
+func (s *slowTokenStore) Authenticate(ctx context.Context, plaintext string) (*database.Token, error) {
+	s.calls.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return s.TokenStore.Authenticate(ctx, plaintext)
+}
+
+func TestAPIRateLimits(t *testing.T) {
+	app := newAPITestApp(database.NewMemoryStore())
+	app.RateLimits = server.RateLimits{
+		Store:    ratelimit.NewMemoryStore(0),
+		Snippets: ratelimit.Budget{Limit: 1, Period: time.Hour},
+		API:      ratelimit.Budget{Limit: 3, Period: time.Minute},
+	}
+	handler := app.NewServeMux()
+
+	userID, first := newAPIToken(t, app, "first@example.com", database.ScopeRead, database.ScopeWrite)
+	second, err := app.TokenStore.Insert(context.Background(), userID, "second", []string{database.ScopeRead, database.ScopeWrite}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not insert token, %v", err)
+	}
+	_, other := newAPIToken(t, app, "other@example.com", database.ScopeRead)
+
+	body := `{"title": "title", "content": "content", "expires": 1}`
+
+	tests := []struct {
+		name          string
+		token         string
+		method        string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{"first snippet is created", first, http.MethodPost, http.StatusCreated, "0"},
+		{"second snippet is over the user's budget", first, http.MethodPost, http.StatusTooManyRequests, "0"},
+		{"another token of the same user shares the budget", second, http.MethodPost, http.StatusTooManyRequests, "0"},
+		{"reads have their own budget", first, http.MethodGet, http.StatusOK, "0"},
+		{"the token's API budget is spent", first, http.MethodGet, http.StatusTooManyRequests, "0"},
+		{"another token has its own API budget", other, http.MethodGet, http.StatusOK, "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, response := serveAPI(t, handler, tt.token, tt.method, "/api/v1/snippets", body)
+
+			assertResponseCode(t, status, tt.wantStatus)
+
+			if got := header.Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("got RateLimit-Remaining %q, want %q", got, tt.wantRemaining)
+			}
+
+			if status != http.StatusTooManyRequests {
+				if got := header.Get("Retry-After"); got != "" {
+					t.Errorf("got Retry-After %q on an allowed request", got)
+				}
+				return
+			}
+
+			if got := header.Get("Retry-After"); got == "" || got == "0" {
+				t.Errorf("got Retry-After %q, want a wait", got)
+			}
+
+			if response.Error.Status != http.StatusTooManyRequests || response.Error.Message == "" {
+				t.Errorf("got error %+v, want a 429 with a message", response.Error)
+			}
+		})
+	}
+
+	t.Run("policy headers describe the budget", func(t *testing.T) {
+		_, header, _ := serveAPI(t, handler, other, http.MethodGet, "/api/v1/snippets", "")
+
+		want := map[string]string{
+			"RateLimit-Policy":    "3;w=60",
+			"RateLimit-Limit":     "3",
+			"RateLimit-Remaining": "1",
+			"RateLimit-Reset":     "40",
+		}
+
+		for name, value := range want {
+			if got := header.Get(name); got != value {
+				t.Errorf("got %s %q, want %q", name, got, value)
+			}
+		}
+	})
+
+	t.Run("a failing limiter lets requests through", func(t *testing.T) {
+		app.RateLimits.Store = failingLimiter{}
+		handler := app.NewServeMux()
+
+		status, header, _ := serveAPI(t, handler, first, http.MethodGet, "/api/v1/snippets", "")
+
+		assertResponseCode(t, status, http.StatusOK)
+
+		if got := header.Get("RateLimit-Limit"); got != "" {
+			t.Errorf("got RateLimit-Limit %q, want no rate limit headers", got)
+		}
+	})
+}
+
+func TestAPIAuthRateLimit(t *testing.T) {
+	app := newAPITestApp(database.NewMemoryStore())
+	app.RateLimits = server.RateLimits{
+		Store: ratelimit.NewMemoryStore(0),
+		Auth:  ratelimit.Budget{Limit: 2, Period: time.Minute},
+	}
+	handler := app.NewServeMux()
+
+	_, token := newAPIToken(t, app, "user@example.com", database.ScopeRead)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"a valid token is not counted", token, http.StatusOK},
+		{"first bad token", "guess-1", http.StatusUnauthorized},
+		{"second bad token", "guess-2", http.StatusUnauthorized},
+		{"third bad token is refused", "guess-3", http.StatusTooManyRequests},
+		{"even a valid token waits out the client's budget", token, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, _ := serveAPI(t, handler, tt.token, http.MethodGet, "/api/v1/snippets", "")
+
+			assertResponseCode(t, status, tt.wantStatus)
+
+			if status == http.StatusTooManyRequests && header.Get("Retry-After") != "30" {
+				t.Errorf("got Retry-After %q, want %q", header.Get("Retry-After"), "30")
+			}
+		})
+	}
+}
+
+func TestAPIAuthRateLimitConcurrent(t *testing.T) {
+	tokens := &slowTokenStore{TokenStore: database.NewMemoryTokenStore()}
+
+	app := newAPITestApp(database.NewMemoryStore())
+	app.TokenStore = tokens
+	app.RateLimits = server.RateLimits{
+		Store: ratelimit.NewMemoryStore(0),
+		Auth:  ratelimit.Budget{Limit: 2, Period: time.Minute},
+	}
+	handler := app.NewServeMux()
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/snippets", nil)
+			r.Header.Set("Authorization", fmt.Sprintf("Bearer guess-%d", i))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+
+	if got := tokens.calls.Load(); got > 2 {
+		t.Errorf("got %d bad tokens checked, want at most the budget of 2", got)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	templateCache, err := templates.NewTemplateCache()
+	if err != nil {
+		t.Fatalf("failed to create template cache: %v", err)
+	}
+
+	app := newAPITestApp(database.NewMemoryStore())
+	app.TemplateCache = templateCache
+	app.RateLimits = server.RateLimits{
+		Store: ratelimit.NewMemoryStore(0),
+		Auth:  ratelimit.Budget{Limit: 2, Period: time.Minute},
+	}
+
+	testServer := httptest.NewServer(app.NewServeMux())
+	defer testServer.Close()
+
+	client := testServer.Client()
+	client.Jar, _ = cookiejar.New(nil)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	loginURL := fmt.Sprintf("%s/user/login", testServer.URL)
+	csrfToken := fetchCSRFToken(t, client, loginURL)
+	form := url.Values{"email": {"nobody@example.com"}, "password": {"wrong"}}
+
+	for i, want := range []int{http.StatusSeeOther, http.StatusSeeOther, http.StatusTooManyRequests} {
+		response, err := postForm(client, loginURL, csrfToken, form)
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != want {
+			t.Errorf("attempt %d: got status %d, want %d", i+1, response.StatusCode, want)
+		}
+
+		if want == http.StatusTooManyRequests && response.Header.Get("Retry-After") != "30" {
+			t.Errorf("got Retry-After %q, want %q", response.Header.Get("Retry-After"), "30")
+		}
+	}
+
+	// The login page itself is not limited.
+	response, err := client.Get(loginURL)
+	if err != nil {
+		t.Fatalf("could not make request to test server, %v", err)
+	}
+	response.Body.Close()
+
+	assertResponseCode(t, response.StatusCode, http.StatusOK)
+}
@@ -1,10 +1,17 @@
 package server
 
 import (
+	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/health"
+	"github.com/andremfp/snippetbox/internal/metrics"
 	"github.com/andremfp/snippetbox/internal/middleware"
 	"github.com/andremfp/snippetbox/internal/templates"
 	"github.com/julienschmidt/httprouter"
@@ -13,38 +20,152 @@ import (
 
 type Webserver http.Server
 
-func NewWebserver(addr string, errorLog *log.Logger, app *Application) *http.Server {
+func NewWebserver(addr string, logger *slog.Logger, app *Application, limits Limits) *http.Server {
 
 	srv := &http.Server{
 		Addr:     addr,
-		ErrorLog: errorLog,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		Handler:  app.NewServeMux(),
 	}
+	limits.apply(srv)
 
 	return srv
 }
 
-func (app *Application) NewServeMux() http.Handler {
+// NewRedirectServer returns a server that sends every request on addr to the
+// same URL over HTTPS on httpsAddr.
+func NewRedirectServer(addr string, httpsAddr string, logger *slog.Logger, limits Limits) *http.Server {
+	srv := &http.Server{
+		Addr:     addr,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		Handler:  redirectToHTTPS(httpsAddr),
+	}
+	limits.apply(srv)
+
+	return srv
+}
+
+// NewAdminServer returns a server for operators rather than users, meant to
+// listen on an address the public cannot reach. It serves the metrics in reg
+// at /metrics, and the probes of checker when it is not nil.
+func NewAdminServer(addr string, logger *slog.Logger, reg *metrics.Registry, checker *health.Checker, limits Limits) *http.Server {
 	router := httprouter.New()
+	router.Handler(http.MethodGet, "/metrics", reg)
+
+	if checker != nil {
+		router.HandlerFunc(http.MethodGet, "/healthz", checker.Live)
+		router.HandlerFunc(http.MethodGet, "/readyz", checker.Ready)
+	}
+
+	srv := &http.Server{
+		Addr:     addr,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		Handler:  router,
+	}
+	limits.apply(srv)
+
+	return srv
+}
+
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+func (app *Application) NewServeMux() http.Handler {
+	router := patternRouter{httprouter.New()}
 
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			app.apiNotFound(w, r)
+			return
+		}
+		app.notFound(w, r)
+	})
+
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			app.apiError(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method), nil)
+			return
+		}
+		app.clientError(w, r, http.StatusMethodNotAllowed)
 	})
 
 	staticDir, err := fs.Sub(templates.Content, "ui/static")
 	if err != nil {
-		app.ErrorLog.Fatal(err)
+		panic(err)
 	}
 
 	staticFileHandler := http.FileServer(http.FS(staticDir))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", staticFileHandler))
 
-	router.HandlerFunc(http.MethodGet, "/", app.HomeHandler)
-	router.HandlerFunc(http.MethodGet, "/snippet/view/:id", app.snippetViewHandler)
-	router.HandlerFunc(http.MethodGet, "/snippet/create", app.snippetCreateHandler)
-	router.HandlerFunc(http.MethodPost, "/snippet/create", app.snippetCreatePostHandler)
+	csrf := middleware.NewCSRF(app.Logger)
+	csrf.Secure = app.Sessions.Cookie.Secure
+
+	// Everything except static files runs with the session loaded and CSRF
+	// checks on forms, and the routes that change snippets need a logged in
+	// user on top. Bodies are capped first, so an oversized request is
+	// refused before its session is loaded.
+	session := alice.New(app.Sessions.LoadAndSave, csrf.Protect, app.authenticate)
+	dynamic := alice.New(app.limitBody(maxFormBytes)).Extend(session)
+
+	// Login and signup attempts are limited by IP, so passwords cannot be
+	// guessed quickly, and creating snippets by user, so no one account can
+	// flood the site whichever way it posts.
+	authForm := dynamic.Append(app.rateLimit("auth", app.RateLimits.Auth, clientIP))
+	limitSnippets := app.rateLimit("snippets", app.RateLimits.Snippets, app.userKey)
+
+	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.HomeHandler))
+	router.Handler(http.MethodGet, "/search", dynamic.ThenFunc(app.searchHandler))
+	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetViewHandler))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetHistoryHandler))
+	router.Handler(http.MethodGet, "/snippet/view/:id/diff", dynamic.ThenFunc(app.snippetDiffHandler))
+	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignupHandler))
+	router.Handler(http.MethodPost, "/user/signup", authForm.ThenFunc(app.userSignupPostHandler))
+	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLoginHandler))
+	router.Handler(http.MethodPost, "/user/login", authForm.ThenFunc(app.userLoginPostHandler))
+
+	protected := dynamic.Append(app.requireAuthentication)
+	snippetForm := alice.New(app.limitBody(maxSnippetBytes)).Extend(session).Append(app.requireAuthentication, limitSnippets)
+
+	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreateHandler))
+	router.Handler(http.MethodPost, "/snippet/create", snippetForm.ThenFunc(app.snippetCreatePostHandler))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditHandler))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", snippetForm.ThenFunc(app.snippetEditPostHandler))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePostHandler))
+	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPostHandler))
+
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.tokensHandler))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.tokenCreatePostHandler))
+	router.Handler(http.MethodPost, "/account/tokens/:id/delete", protected.ThenFunc(app.tokenDeletePostHandler))
+
+	// The API authenticates with bearer tokens rather than sessions, so it
+	// needs no CSRF checks either.
+	api := alice.New(app.limitBody(maxJSONBytes), app.limitFailures("api-auth", app.RateLimits.Auth, http.StatusUnauthorized, clientIP), app.authenticateAPI, app.rateLimit("api", app.RateLimits.API, app.tokenKey))
+	read := api.Append(app.requireScope(database.ScopeRead))
+	write := api.Append(app.requireScope(database.ScopeWrite))
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", read.ThenFunc(app.apiListSnippetsHandler))
+	router.Handler(http.MethodPost, "/api/v1/snippets", write.Append(limitSnippets).ThenFunc(app.apiCreateSnippetHandler))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", read.ThenFunc(app.apiGetSnippetHandler))
 
-	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, middleware.SecureHeaders)
+	// Panics are recovered inside logRequest and measureRequest, so the 500
+	// they end in is logged and counted like any other response.
+	standardMiddleware := alice.New(middleware.AssignRequestID, app.logRequest, app.measureRequest, app.recoverPanic, middleware.SecureHeaders)
 
 	return standardMiddleware.Then(router)
 }
@@ -1,65 +1,47 @@
 package server_test
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/andremfp/snippetbox/internal/database"
 	"github.com/andremfp/snippetbox/internal/server"
+	"github.com/andremfp/snippetbox/internal/session"
 	"github.com/andremfp/snippetbox/internal/templates"
 	"github.com/go-playground/form/v4"
 )
 
-type StubSnippetStore struct {
-	Snippets []database.Snippet
-}
-
-func (s *StubSnippetStore) Insert(title, content string, expires int) (int, error) {
-	testSnippet := database.Snippet{
-		ID:      1,
-		Title:   "test title",
-		Content: "test content",
-		Created: time.Date(2024, time.March, 21, 16, 17, 51, 0, time.UTC),
-		Expires: time.Date(2024, time.March, 21, 17, 17, 51, 0, time.UTC),
-	}
-
-	s.Snippets = append(s.Snippets, testSnippet)
-
-	return testSnippet.ID, nil
-}
-
-func (s *StubSnippetStore) Get(id int) (*database.Snippet, error) {
-	if id > len(s.Snippets) {
-		return nil, database.ErrNoRecord
-	}
-
-	return &s.Snippets[0], nil
-}
-
-func (s *StubSnippetStore) Latest() ([]*database.Snippet, error) {
-
-	return nil, nil
-}
-
 var testApp = &server.Application{
-	InfoLog:     log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
-	ErrorLog:    log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
+	Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
 	FormDecoder: form.NewDecoder(),
 }
 
 func TestServer(t *testing.T) {
 
-	testApp.SnippetStore = &StubSnippetStore{}
+	testApp.SnippetStore = database.NewMemoryStore()
+	testApp.UserStore = database.NewMemoryUserStore()
+	testApp.TokenStore = database.NewMemoryTokenStore()
+	testApp.Sessions = session.New(session.NewMemoryStore(0))
 	testServer := httptest.NewServer(testApp.NewServeMux())
 	testClient := testServer.Client()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("could not create cookie jar, %v", err)
+	}
+	testClient.Jar = jar
+
 	testClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
@@ -73,6 +55,23 @@ func TestServer(t *testing.T) {
 
 	defer testServer.Close()
 
+	csrfToken := fetchCSRFToken(t, testClient, fmt.Sprintf("%s/user/login", testServer.URL))
+
+	t.Run("POST without a valid CSRF token returns 400", func(t *testing.T) {
+
+		tokens := []string{"", "not-a-token", fetchCSRFToken(t, &http.Client{}, fmt.Sprintf("%s/user/login", testServer.URL))}
+
+		for _, token := range tokens {
+			response, err := postForm(testClient, fmt.Sprintf("%s/user/login", testServer.URL), token, url.Values{})
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+
+			assertResponseCode(t, response.StatusCode, http.StatusBadRequest)
+		}
+
+	})
+
 	t.Run("root path returns 200", func(t *testing.T) {
 
 		response, err := testClient.Get(fmt.Sprintf("%s/", testServer.URL))
@@ -84,14 +83,185 @@ func TestServer(t *testing.T) {
 
 	})
 
-	t.Run("display existing snippet returns 200", func(t *testing.T) {
+	t.Run("creating snippets needs a login", func(t *testing.T) {
+
+		getResponse, err := testClient.Get(fmt.Sprintf("%s/snippet/create", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		postResponse, err := postForm(testClient, fmt.Sprintf("%s/snippet/create", testServer.URL), csrfToken, url.Values{})
+		if err != nil {
+			t.Fatalf("could not make create request to test server, %v", err)
+		}
+
+		for _, response := range []*http.Response{getResponse, postResponse} {
+			assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+			if got, want := response.Header.Get("Location"), "/user/login"; got != want {
+				t.Errorf("got redirect %s, want %s", got, want)
+			}
+		}
+
+	})
+
+	t.Run("/user/signup POST creates a user and redirects to login", func(t *testing.T) {
+
+		formData := url.Values{
+			"name":     {"Alice"},
+			"email":    {"alice@example.com"},
+			"password": {"pa55word"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/user/signup", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make signup request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		if got, want := response.Header.Get("Location"), "/user/login"; got != want {
+			t.Errorf("got redirect %s, want %s", got, want)
+		}
+
+	})
+
+	t.Run("/user/signup POST with invalid or taken details returns 303", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			formData url.Values
+			want     string
+		}{
+			{
+				name:     "blank name",
+				formData: url.Values{"name": {""}, "email": {"bob@example.com"}, "password": {"pa55word"}},
+				want:     "This field cannot be blank",
+			},
+			{
+				name:     "invalid email",
+				formData: url.Values{"name": {"Bob"}, "email": {"bob@"}, "password": {"pa55word"}},
+				want:     "This field must be a valid email address",
+			},
+			{
+				name:     "short password",
+				formData: url.Values{"name": {"Bob"}, "email": {"bob@example.com"}, "password": {"pa55"}},
+				want:     "This field must be at least 8 characters long",
+			},
+			{
+				name:     "password too long for bcrypt",
+				formData: url.Values{"name": {"Bob"}, "email": {"bob@example.com"}, "password": {strings.Repeat("é", 37)}},
+				want:     "This field must be at most 72 bytes long",
+			},
+			{
+				name:     "email in use",
+				formData: url.Values{"name": {"Bob"}, "email": {"alice@example.com"}, "password": {"pa55word"}},
+				want:     "Email address is already in use",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response, err := postForm(testClient, fmt.Sprintf("%s/user/signup", testServer.URL), csrfToken, tt.formData)
+				if err != nil {
+					t.Fatalf("could not make signup request to test server, %v", err)
+				}
+				defer response.Body.Close()
+
+				body, _ := io.ReadAll(response.Body)
+
+				assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+				if !strings.Contains(string(body), tt.want) {
+					t.Errorf("response does not contain %q", tt.want)
+				}
+
+				if strings.Contains(string(body), "pa55word") {
+					t.Error("response contains the password")
+				}
+			})
+		}
+
+	})
+
+	t.Run("/user/login POST with a wrong password returns 303", func(t *testing.T) {
 
 		formData := url.Values{
-			"title":   {"test title"},
-			"content": {"test content"},
+			"email":    {"alice@example.com"},
+			"password": {"wrong password"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/user/login", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make login request to test server, %v", err)
+		}
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		if !strings.Contains(string(body), "Email or password is incorrect") {
+			t.Error("response does not say the login failed")
+		}
+
+	})
+
+	t.Run("/user/login POST logs in and redirects to create", func(t *testing.T) {
+
+		formData := url.Values{
+			"email":    {"alice@example.com"},
+			"password": {"pa55word"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/user/login", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make login request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		if got, want := response.Header.Get("Location"), "/snippet/create"; got != want {
+			t.Errorf("got redirect %s, want %s", got, want)
+		}
+
+	})
+
+	t.Run("a bearer token does not excuse a logged in form post from CSRF checks", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {"forged"},
+			"content": {"forged"},
 			"expires": {"7"},
 		}
 
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/snippet/create", testServer.URL), strings.NewReader(formData.Encode()))
+		if err != nil {
+			t.Fatalf("could not create POST request: %v", err)
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer anything")
+
+		response, err := testClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not make create request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusBadRequest)
+
+	})
+
+	t.Run("display existing snippet returns 200", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":    {"test title"},
+			"content":  {"test content"},
+			"language": {"python"},
+			"expires":  {"7"},
+		}
+
+		formData.Set("csrf_token", csrfToken)
+
 		req, err := http.NewRequest("POST", fmt.Sprintf("%s/snippet/create", testServer.URL), strings.NewReader(formData.Encode()))
 		if err != nil {
 			t.Fatalf("could not create POST request: %v", err)
@@ -114,6 +284,19 @@ func TestServer(t *testing.T) {
 
 		assertResponseCode(t, getResponse.StatusCode, http.StatusOK)
 
+		snippet, err := testApp.SnippetStore.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("could not get created snippet, %v", err)
+		}
+
+		if snippet.UserID != 1 {
+			t.Errorf("got author %d, want the logged in user 1", snippet.UserID)
+		}
+
+		if snippet.Language != "python" {
+			t.Errorf("got language %q, want %q", snippet.Language, "python")
+		}
+
 	})
 
 	t.Run("snippet not found", func(t *testing.T) {
@@ -131,7 +314,7 @@ func TestServer(t *testing.T) {
 			t.Fatalf("could not read response body, %v", err)
 		}
 
-		want := "Not Found\n"
+		want := "Not Found\nRequest ID: " + response.Header.Get("X-Request-ID") + "\n"
 
 		assertResponseBody(t, string(got), want)
 		assertResponseCode(t, response.StatusCode, http.StatusNotFound)
@@ -151,7 +334,7 @@ func TestServer(t *testing.T) {
 			t.Fatalf("could not read response body, %v", err)
 		}
 
-		want := "Not Found\n"
+		want := "Not Found\nRequest ID: " + response.Header.Get("X-Request-ID") + "\n"
 
 		assertResponseBody(t, string(got), want)
 		assertResponseCode(t, response.StatusCode, http.StatusNotFound)
@@ -166,6 +349,8 @@ func TestServer(t *testing.T) {
 			"expires": {"1"},
 		}
 
+		formData.Set("csrf_token", csrfToken)
+
 		req, err := http.NewRequest("POST", fmt.Sprintf("%s/snippet/create", testServer.URL), strings.NewReader(formData.Encode()))
 		if err != nil {
 			t.Fatalf("could not create POST request: %v", err)
@@ -178,8 +363,9 @@ func TestServer(t *testing.T) {
 			t.Fatalf("could not make create request to test server, %v", err)
 		}
 
+		// The snippet created by the previous subtest already took ID 1
 		gotRedirect := response.Header.Get("Location")
-		wantRedirect := "/snippet/view/1"
+		wantRedirect := "/snippet/view/2"
 
 		if gotRedirect != wantRedirect {
 			t.Errorf("got redirect %s, want %s", gotRedirect, wantRedirect)
@@ -197,6 +383,8 @@ func TestServer(t *testing.T) {
 			"expires": {"1"},
 		}
 
+		formData.Set("csrf_token", csrfToken)
+
 		req, err := http.NewRequest("POST", fmt.Sprintf("%s/snippet/create", testServer.URL), strings.NewReader(formData.Encode()))
 		if err != nil {
 			t.Fatalf("could not create POST request: %v", err)
@@ -223,6 +411,371 @@ func TestServer(t *testing.T) {
 
 	})
 
+	t.Run("/snippet/edit GET returns 200 for existing snippet", func(t *testing.T) {
+		response, err := testClient.Get(fmt.Sprintf("%s/snippet/edit/1", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusOK)
+
+	})
+
+	t.Run("/snippet/edit POST updates snippet and redirects to snippet view", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {"edited title"},
+			"content": {"edited content"},
+			"expires": {"7"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/snippet/edit/1", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make edit request to test server, %v", err)
+		}
+
+		gotRedirect := response.Header.Get("Location")
+		wantRedirect := "/snippet/view/1"
+
+		if gotRedirect != wantRedirect {
+			t.Errorf("got redirect %s, want %s", gotRedirect, wantRedirect)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		snippet, err := testApp.SnippetStore.Get(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("could not get edited snippet, %v", err)
+		}
+
+		if snippet.Title != "edited title" || snippet.Content != "edited content" {
+			t.Errorf("got snippet %+v, want edited title and content", snippet)
+		}
+
+	})
+
+	t.Run("/snippet/edit POST with invalid form data returns 303", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {""},
+			"content": {"edited content"},
+			"expires": {"7"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/snippet/edit/1", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make edit request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+	})
+
+	t.Run("edited snippet has history and diff pages", func(t *testing.T) {
+		for _, path := range []string{
+			"/snippet/view/1/history",
+			"/snippet/view/1/diff",
+			"/snippet/view/1/diff?from=1&to=2",
+			"/snippet/view/1?revision=1",
+		} {
+			response, err := testClient.Get(testServer.URL + path)
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+
+			assertResponseCode(t, response.StatusCode, http.StatusOK)
+		}
+
+	})
+
+	t.Run("unknown revisions return 404", func(t *testing.T) {
+		for _, path := range []string{
+			"/snippet/view/1?revision=99",
+			"/snippet/view/1?revision=abc",
+			"/snippet/view/1/diff?from=99",
+			"/snippet/view/99/history",
+		} {
+			response, err := testClient.Get(testServer.URL + path)
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+
+			assertResponseCode(t, response.StatusCode, http.StatusNotFound)
+		}
+
+	})
+
+	t.Run("/snippet/delete POST removes snippet and redirects home", func(t *testing.T) {
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/snippet/delete/2", testServer.URL), csrfToken, nil)
+		if err != nil {
+			t.Fatalf("could not make delete request to test server, %v", err)
+		}
+
+		gotRedirect := response.Header.Get("Location")
+		wantRedirect := "/"
+
+		if gotRedirect != wantRedirect {
+			t.Errorf("got redirect %s, want %s", gotRedirect, wantRedirect)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+	})
+
+	t.Run("flash messages show once after the redirect", func(t *testing.T) {
+
+		first, err := testClient.Get(fmt.Sprintf("%s/", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		firstBody, _ := io.ReadAll(first.Body)
+
+		second, err := testClient.Get(fmt.Sprintf("%s/", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		secondBody, _ := io.ReadAll(second.Body)
+
+		if !strings.Contains(string(firstBody), "Snippet successfully deleted!") {
+			t.Errorf("got no flash message after deleting, want %q", "Snippet successfully deleted!")
+		}
+
+		if strings.Contains(string(secondBody), "Snippet successfully deleted!") {
+			t.Error("got the flash message again on the next page")
+		}
+
+	})
+
+	t.Run("queued flash messages are all shown", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {"edited title"},
+			"content": {"edited content"},
+			"expires": {"7"},
+		}
+
+		for range 2 {
+			if _, err := postForm(testClient, fmt.Sprintf("%s/snippet/edit/1", testServer.URL), csrfToken, formData); err != nil {
+				t.Fatalf("could not make edit request to test server, %v", err)
+			}
+		}
+
+		response, err := testClient.Get(fmt.Sprintf("%s/snippet/view/1", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		body, _ := io.ReadAll(response.Body)
+
+		if got := strings.Count(string(body), "Snippet successfully updated!"); got != 2 {
+			t.Errorf("got %d flash messages, want 2", got)
+		}
+
+	})
+
+	t.Run("editing or deleting a deleted snippet returns 404", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {"edited title"},
+			"content": {"edited content"},
+			"expires": {"7"},
+		}
+
+		editGetResponse, err := testClient.Get(fmt.Sprintf("%s/snippet/edit/2", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		editPostResponse, err := postForm(testClient, fmt.Sprintf("%s/snippet/edit/2", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make edit request to test server, %v", err)
+		}
+
+		deleteResponse, err := postForm(testClient, fmt.Sprintf("%s/snippet/delete/2", testServer.URL), csrfToken, nil)
+		if err != nil {
+			t.Fatalf("could not make delete request to test server, %v", err)
+		}
+
+		assertResponseCode(t, editGetResponse.StatusCode, http.StatusNotFound)
+		assertResponseCode(t, editPostResponse.StatusCode, http.StatusNotFound)
+		assertResponseCode(t, deleteResponse.StatusCode, http.StatusNotFound)
+
+	})
+
+	t.Run("editing or deleting someone else's snippet returns 403", func(t *testing.T) {
+
+		formData := url.Values{
+			"title":   {"hijacked"},
+			"content": {"hijacked"},
+			"expires": {"7"},
+		}
+
+		// One snippet by another user, and one from before user accounts.
+		for _, author := range []int{2, 0} {
+			id, err := testApp.SnippetStore.Insert(context.Background(), "theirs", "their content", "", 7, author)
+			if err != nil {
+				t.Fatalf("could not insert snippet, %v", err)
+			}
+
+			viewResponse, err := testClient.Get(fmt.Sprintf("%s/snippet/view/%d", testServer.URL, id))
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+			viewBody, _ := io.ReadAll(viewResponse.Body)
+			viewResponse.Body.Close()
+
+			if strings.Contains(string(viewBody), "/snippet/edit/") || strings.Contains(string(viewBody), "/snippet/delete/") {
+				t.Errorf("got edit or delete actions on snippet by user %d", author)
+			}
+
+			editGetResponse, err := testClient.Get(fmt.Sprintf("%s/snippet/edit/%d", testServer.URL, id))
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+
+			editPostResponse, err := postForm(testClient, fmt.Sprintf("%s/snippet/edit/%d", testServer.URL, id), csrfToken, formData)
+			if err != nil {
+				t.Fatalf("could not make edit request to test server, %v", err)
+			}
+
+			deleteResponse, err := postForm(testClient, fmt.Sprintf("%s/snippet/delete/%d", testServer.URL, id), csrfToken, nil)
+			if err != nil {
+				t.Fatalf("could not make delete request to test server, %v", err)
+			}
+
+			assertResponseCode(t, editGetResponse.StatusCode, http.StatusForbidden)
+			assertResponseCode(t, editPostResponse.StatusCode, http.StatusForbidden)
+			assertResponseCode(t, deleteResponse.StatusCode, http.StatusForbidden)
+
+			snippet, err := testApp.SnippetStore.Get(context.Background(), id)
+			if err != nil {
+				t.Fatalf("could not get snippet by user %d, %v", author, err)
+			}
+
+			if snippet.Title != "theirs" || snippet.Revision != 1 {
+				t.Errorf("got snippet %+v, want it unchanged", snippet)
+			}
+		}
+
+	})
+
+	t.Run("API tokens are shown once, work with the API and can be revoked", func(t *testing.T) {
+
+		formData := url.Values{
+			"name":    {"script"},
+			"scopes":  {"read"},
+			"expires": {"30"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/account/tokens", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		first, err := testClient.Get(fmt.Sprintf("%s/account/tokens", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		firstBody, _ := io.ReadAll(first.Body)
+
+		matches := regexp.MustCompile(`<code>(sbx_[^<]+)</code>`).FindSubmatch(firstBody)
+		if matches == nil {
+			t.Fatal("got no new token on the tokens page")
+		}
+		token := string(matches[1])
+
+		second, err := testClient.Get(fmt.Sprintf("%s/account/tokens", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		secondBody, _ := io.ReadAll(second.Body)
+
+		if strings.Contains(string(secondBody), token) {
+			t.Error("got the token shown a second time")
+		}
+
+		if !strings.Contains(string(secondBody), "<td>script</td>") {
+			t.Error("got no script token in the list")
+		}
+
+		apiGet := func() int {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/snippets/1", testServer.URL), nil)
+			if err != nil {
+				t.Fatalf("could not create request, %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			response, err := testClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not make request to test server, %v", err)
+			}
+			response.Body.Close()
+
+			return response.StatusCode
+		}
+
+		assertResponseCode(t, apiGet(), http.StatusOK)
+
+		revokeResponse, err := postForm(testClient, fmt.Sprintf("%s/account/tokens/1/delete", testServer.URL), csrfToken, nil)
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		assertResponseCode(t, revokeResponse.StatusCode, http.StatusSeeOther)
+		assertResponseCode(t, apiGet(), http.StatusUnauthorized)
+
+	})
+
+	t.Run("/account/tokens POST with invalid data returns 303", func(t *testing.T) {
+
+		formData := url.Values{
+			"name":    {""},
+			"scopes":  {"admin"},
+			"expires": {"30"},
+		}
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/account/tokens", testServer.URL), csrfToken, formData)
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+		body, _ := io.ReadAll(response.Body)
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		for _, want := range []string{"This field cannot be blank", "Scopes must be read or write"} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("got no %q error", want)
+			}
+		}
+
+	})
+
+	t.Run("/user/logout POST logs out and redirects home", func(t *testing.T) {
+
+		response, err := postForm(testClient, fmt.Sprintf("%s/user/logout", testServer.URL), csrfToken, nil)
+		if err != nil {
+			t.Fatalf("could not make logout request to test server, %v", err)
+		}
+
+		assertResponseCode(t, response.StatusCode, http.StatusSeeOther)
+
+		if got, want := response.Header.Get("Location"), "/"; got != want {
+			t.Errorf("got redirect %s, want %s", got, want)
+		}
+
+		createResponse, err := testClient.Get(fmt.Sprintf("%s/snippet/create", testServer.URL))
+		if err != nil {
+			t.Fatalf("could not make request to test server, %v", err)
+		}
+
+		if got, want := createResponse.Header.Get("Location"), "/user/login"; got != want {
+			t.Errorf("got redirect %s after logout, want %s", got, want)
+		}
+
+	})
+
 	t.Run("/static/ returns 200", func(t *testing.T) {
 		response, err := testClient.Get(fmt.Sprintf("%s/static/", testServer.URL))
 		if err != nil {
@@ -246,7 +799,7 @@ func TestServer(t *testing.T) {
 			t.Fatalf("could not read response body, %v", err)
 		}
 
-		want := "Not Found\n"
+		want := "Not Found\nRequest ID: " + response.Header.Get("X-Request-ID") + "\n"
 
 		assertResponseBody(t, string(got), want)
 		assertResponseCode(t, response.StatusCode, http.StatusNotFound)
@@ -254,6 +807,377 @@ func TestServer(t *testing.T) {
 	})
 }
 
+// failingStore is a Store whose every call fails with err.
+type failingStore struct {
+	err error
+}
+
+func (s *failingStore) Insert(ctx context.Context, title, content, language string, expires int, userID int) (int, error) {
+	return 0, s.err
+}
+
+func (s *failingStore) Get(ctx context.Context, id int) (*database.Snippet, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) GetRevision(ctx context.Context, id int, revision int) (*database.Snippet, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) Revisions(ctx context.Context, id int) ([]*database.Revision, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) Latest(ctx context.Context, cursor database.Cursor) ([]*database.Snippet, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) Search(ctx context.Context, query string, cursor database.Cursor) ([]*database.Snippet, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) Update(ctx context.Context, id int, title, content, language string, expires int) error {
+	return s.err
+}
+
+func (s *failingStore) Delete(ctx context.Context, id int) error {
+	return s.err
+}
+
+func (s *failingStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	return 0, s.err
+}
+
+func (s *failingStore) Count(ctx context.Context) (int, error) {
+	return 0, s.err
+}
+
+func TestDatabaseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{
+			name:       "query timeout returns 504",
+			err:        database.ErrTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "canceled query returns 503",
+			err:        database.ErrCanceled,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "any other error returns 500",
+			err:        database.ErrGeneric,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &server.Application{
+				Logger:       testApp.Logger,
+				SnippetStore: &failingStore{err: tt.err},
+				UserStore:    database.NewMemoryUserStore(),
+				Sessions:     session.New(session.NewMemoryStore(0)),
+				FormDecoder:  form.NewDecoder(),
+			}
+
+			for _, path := range []string{"/", "/search?q=title", "/snippet/view/1"} {
+				w := httptest.NewRecorder()
+				app.NewServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+				assertResponseCode(t, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHomePagination(t *testing.T) {
+	store := database.NewMemoryStore()
+	for i := 0; i < 5; i++ {
+		store.Insert(context.Background(), fmt.Sprintf("title%d", i+1), "content", "", 7, 0)
+	}
+
+	templateCache, err := templates.NewTemplateCache()
+	if err != nil {
+		t.Fatalf("failed to create template cache: %v", err)
+	}
+
+	app := &server.Application{
+		Logger:        testApp.Logger,
+		SnippetStore:  store,
+		UserStore:     database.NewMemoryUserStore(),
+		Sessions:      session.New(session.NewMemoryStore(0)),
+		TemplateCache: templateCache,
+		FormDecoder:   form.NewDecoder(),
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string
+		wantNot    []string
+	}{
+		{
+			name:       "first page links only to older snippets",
+			path:       "/?limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{"title5", "title4", "/?before=4&amp;limit=2"},
+			wantNot:    []string{"title3", "after="},
+		},
+		{
+			name:       "middle page links both ways",
+			path:       "/?before=4&limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{"title3", "title2", "/?after=3&amp;limit=2", "/?before=2&amp;limit=2"},
+		},
+		{
+			name:       "last page links only to newer snippets",
+			path:       "/?before=2&limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{"title1", "/?after=1&amp;limit=2"},
+			wantNot:    []string{"before="},
+		},
+		{
+			name:       "paging back to the newest snippets drops the newer link",
+			path:       "/?after=3&limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{"title5", "title4", "/?before=4&amp;limit=2"},
+			wantNot:    []string{"after="},
+		},
+		{
+			name:       "default page size leaves the limit out of links",
+			path:       "/?before=5",
+			wantStatus: http.StatusOK,
+			want:       []string{"title4", "title1", "/?after=4"},
+			wantNot:    []string{"limit=", "before="},
+		},
+		{
+			name:       "oversized limit is capped",
+			path:       "/?limit=100000",
+			wantStatus: http.StatusOK,
+			want:       []string{"title5", "title1"},
+		},
+		{
+			name:       "invalid cursor returns 400",
+			path:       "/?before=abc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "zero limit returns 400",
+			path:       "/?limit=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "before and after together return 400",
+			path:       "/?before=4&after=1",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.NewServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assertResponseCode(t, w.Code, tt.wantStatus)
+
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("response does not contain %q", want)
+				}
+			}
+
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(w.Body.String(), unwanted) {
+					t.Errorf("response contains %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := database.NewMemoryStore()
+	store.Insert(context.Background(), "Lighthouse keeper", "Keeps the light on.", "", 7, 0)
+	store.Insert(context.Background(), "Windmill", "Grinds the lighthouse keeper's flour.", "", 7, 0)
+	store.Insert(context.Background(), "Old lighthouse", "Long gone.", "", -1, 0)
+
+	templateCache, err := templates.NewTemplateCache()
+	if err != nil {
+		t.Fatalf("failed to create template cache: %v", err)
+	}
+
+	app := &server.Application{
+		Logger:        testApp.Logger,
+		SnippetStore:  store,
+		UserStore:     database.NewMemoryUserStore(),
+		Sessions:      session.New(session.NewMemoryStore(0)),
+		TemplateCache: templateCache,
+		FormDecoder:   form.NewDecoder(),
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string
+		wantNot    []string
+	}{
+		{
+			name:       "matches are listed and highlighted",
+			path:       "/search?q=lighthouse",
+			wantStatus: http.StatusOK,
+			want:       []string{"<mark>Lighthouse</mark> keeper", "<mark>lighthouse</mark> keeper&#39;s flour"},
+			wantNot:    []string{"Old"},
+		},
+		{
+			name:       "every term must match",
+			path:       "/search?q=light+grind",
+			wantStatus: http.StatusOK,
+			want:       []string{"Windmill"},
+			wantNot:    []string{"Keeps the light on"},
+		},
+		{
+			name:       "no matches says so",
+			path:       "/search?q=submarine",
+			wantStatus: http.StatusOK,
+			want:       []string{"No snippets match <strong>submarine</strong>"},
+		},
+		{
+			name:       "empty query shows only the form",
+			path:       "/search",
+			wantStatus: http.StatusOK,
+			want:       []string{"name='q'"},
+			wantNot:    []string{"No snippets match", "<table>"},
+		},
+		{
+			name:       "pagination keeps the query",
+			path:       "/search?q=keeper&limit=1",
+			wantStatus: http.StatusOK,
+			want:       []string{"Windmill", "/search?before=2&amp;limit=1&amp;q=keeper"},
+		},
+		{
+			name:       "invalid cursor returns 400",
+			path:       "/search?q=keeper&before=x",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.NewServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assertResponseCode(t, w.Code, tt.wantStatus)
+
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("response does not contain %q", want)
+				}
+			}
+
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(w.Body.String(), unwanted) {
+					t.Errorf("response contains %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='([^']+)'>`)
+
+// fetchCSRFToken gets the page at url with client, leaving the CSRF cookie
+// in its jar, and returns the token from the page's form.
+func fetchCSRFToken(t testing.TB, client *http.Client, url string) string {
+	t.Helper()
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("could not make request to test server, %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("could not read response body, %v", err)
+	}
+
+	matches := csrfTokenRX.FindSubmatch(body)
+	if matches == nil {
+		t.Fatalf("no CSRF token in %s", url)
+	}
+
+	return string(matches[1])
+}
+
+func TestRedirectServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		target    string
+		want      string
+	}{
+		{
+			name:      "default HTTPS port",
+			httpsAddr: ":443",
+			target:    "http://example.com:8080/snippet/view/1?page=2",
+			want:      "https://example.com/snippet/view/1?page=2",
+		},
+		{
+			name:      "other HTTPS port",
+			httpsAddr: ":4000",
+			target:    "http://localhost:8080/",
+			want:      "https://localhost:4000/",
+		},
+		{
+			name:      "host without a port",
+			httpsAddr: ":4000",
+			target:    "http://example.com/search?q=a%20b",
+			want:      "https://example.com:4000/search?q=a%20b",
+		},
+		{
+			name:      "IPv6 host",
+			httpsAddr: ":4000",
+			target:    "http://[::1]/",
+			want:      "https://[::1]:4000/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := server.NewRedirectServer(":8080", tt.httpsAddr, testApp.Logger, server.Limits{}).Handler
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.target, nil))
+
+			assertResponseCode(t, w.Code, http.StatusPermanentRedirect)
+
+			if got := w.Header().Get("Location"); got != tt.want {
+				t.Errorf("got Location %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// postForm is Client.PostForm with the CSRF token added to data.
+func postForm(client *http.Client, target string, csrfToken string, data url.Values) (*http.Response, error) {
+	form := url.Values{}
+	for key, values := range data {
+		form[key] = values
+	}
+
+	if csrfToken != "" {
+		form.Set("csrf_token", csrfToken)
+	}
+
+	return client.PostForm(target, form)
+}
+
 func assertResponseBody(t testing.TB, got, want string) {
 	t.Helper()
 	if got != want {
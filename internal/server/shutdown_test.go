@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/certs"
+	"github.com/andremfp/snippetbox/internal/server"
+)
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name         string
+		drainTimeout time.Duration
+		handlerDelay time.Duration
+		wantErr      error
+		wantStatus   int
+	}{
+		{
+			name:         "in-flight requests finish before shutdown",
+			drainTimeout: 5 * time.Second,
+			handlerDelay: 100 * time.Millisecond,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "requests outlasting the drain timeout are cut off",
+			drainTimeout: 50 * time.Millisecond,
+			handlerDelay: 5 * time.Second,
+			wantErr:      context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			srv := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-time.After(tt.handlerDelay):
+					case <-r.Context().Done():
+						return
+					}
+					io.WriteString(w, "OK")
+				}),
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("could not listen, %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			served := make(chan error, 1)
+			go func() {
+				served <- server.Serve(ctx, srv, ln, tt.drainTimeout)
+			}()
+
+			responded := make(chan int, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err != nil {
+					responded <- 0
+					return
+				}
+				resp.Body.Close()
+				responded <- resp.StatusCode
+			}()
+
+			<-started
+			cancel()
+
+			if err := <-served; !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got := <-responded; got != tt.wantStatus {
+				t.Errorf("got status %d, want %d", got, tt.wantStatus)
+			}
+
+			if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+				t.Error("got a response after shutdown, want the listener closed")
+			}
+		})
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certPEM, keyPEM, err := certs.SelfSigned(time.Hour, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("could not generate certificate, %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not parse certificate, %v", err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "OK")
+		}),
+		TLSConfig: certs.TLSConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		}),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, srv, ln, time.Second)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+
+	tests := []struct {
+		name       string
+		maxVersion uint16
+		wantErr    bool
+	}{
+		{name: "TLS 1.3", maxVersion: tls.VersionTLS13},
+		{name: "TLS 1.2", maxVersion: tls.VersionTLS12},
+		{name: "TLS 1.1 is refused", maxVersion: tls.VersionTLS11, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS10, MaxVersion: tt.maxVersion},
+				},
+			}
+
+			resp, err := client.Get("https://" + ln.Addr().String())
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Error("got a response, want the handshake refused")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("could not get, %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.TLS == nil || resp.TLS.Version != tt.maxVersion {
+				t.Errorf("got connection state %+v, want version %x", resp.TLS, tt.maxVersion)
+			}
+		})
+	}
+
+	cancel()
+
+	if err := <-served; err != nil {
+		t.Errorf("got error %v shutting down, want nil", err)
+	}
+}
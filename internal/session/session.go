@@ -0,0 +1,391 @@
+// Package session keeps per-visitor state on the server, keyed by a random
+// token that the browser holds in a cookie.
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type contextKey struct{}
+
+// Manager loads a session for every request that passes through LoadAndSave
+// and saves it to Store again before the response is written.
+type Manager struct {
+	Store Store
+	// Lifetime is how long a session lasts at most, however active it is.
+	Lifetime time.Duration
+	// IdleTimeout ends a session early when it goes unused for this long.
+	// Zero means sessions only end at Lifetime.
+	IdleTimeout time.Duration
+	Cookie      Cookie
+	// ErrorFunc answers a request whose session could not be loaded or
+	// saved. It defaults to a plain 500.
+	ErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Cookie holds the attributes of the session cookie.
+type Cookie struct {
+	Name     string
+	Domain   string
+	Path     string
+	HttpOnly bool
+	SameSite http.SameSite
+	// Secure stops the browser sending the cookie over plain HTTP.
+	Secure bool
+	// Persist keeps the cookie after the browser is closed, until the
+	// session expires.
+	Persist bool
+}
+
+// data is what gets encoded into the store.
+type data struct {
+	Deadline time.Time
+	Values   map[string]any
+}
+
+// state is the session of one request.
+type state struct {
+	mu        sync.Mutex
+	token     string
+	data      data
+	modified  bool
+	destroyed bool
+}
+
+// New returns a Manager keeping sessions in store, with a 12 hour lifetime
+// and an HttpOnly, SameSite=Lax cookie. Secure is left off so sessions work
+// over plain HTTP in development; turn it on when serving HTTPS.
+func New(store Store) *Manager {
+	return &Manager{
+		Store:    store,
+		Lifetime: 12 * time.Hour,
+		Cookie: Cookie{
+			Name:     "session",
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			Persist:  true,
+		},
+		ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		},
+	}
+}
+
+// LoadAndSave is middleware that makes the session available to the handlers
+// after it. Changes are saved when the response headers are written, so they
+// must be made before then.
+func (m *Manager) LoadAndSave(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Cookie")
+
+		st, err := m.load(r)
+		if err != nil {
+			m.ErrorFunc(w, r, err)
+			return
+		}
+
+		sw := &sessionWriter{ResponseWriter: w, save: func() {
+			if err := m.save(w, r, st); err != nil {
+				m.ErrorFunc(w, r, err)
+			}
+		}}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), contextKey{}, st)))
+
+		sw.commit()
+	})
+}
+
+func (m *Manager) Get(ctx context.Context, key string) any {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.data.Values[key]
+}
+
+func (m *Manager) Put(ctx context.Context, key string, value any) {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.data.Values[key] = value
+	st.modified = true
+}
+
+// Pop returns the value for key and removes it, for one-time values such as
+// flash messages.
+func (m *Manager) Pop(ctx context.Context, key string) any {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	value, ok := st.data.Values[key]
+	if !ok {
+		return nil
+	}
+
+	delete(st.data.Values, key)
+	st.modified = true
+
+	return value
+}
+
+func (m *Manager) Remove(ctx context.Context, key string) {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.data.Values[key]; ok {
+		delete(st.data.Values, key)
+		st.modified = true
+	}
+}
+
+func (m *Manager) Exists(ctx context.Context, key string) bool {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	_, ok := st.data.Values[key]
+	return ok
+}
+
+// GetString returns the string for key, or "" if there is none.
+func (m *Manager) GetString(ctx context.Context, key string) string {
+	value, _ := m.Get(ctx, key).(string)
+	return value
+}
+
+// GetInt returns the int for key, or 0 if there is none.
+func (m *Manager) GetInt(ctx context.Context, key string) int {
+	value, _ := m.Get(ctx, key).(int)
+	return value
+}
+
+// GetBool returns the bool for key, or false if there is none.
+func (m *Manager) GetBool(ctx context.Context, key string) bool {
+	value, _ := m.Get(ctx, key).(bool)
+	return value
+}
+
+// GetTime returns the time for key, or the zero time if there is none.
+func (m *Manager) GetTime(ctx context.Context, key string) time.Time {
+	value, _ := m.Get(ctx, key).(time.Time)
+	return value
+}
+
+// PopString is Pop for a string value.
+func (m *Manager) PopString(ctx context.Context, key string) string {
+	value, _ := m.Pop(ctx, key).(string)
+	return value
+}
+
+// PopInt is Pop for an int value.
+func (m *Manager) PopInt(ctx context.Context, key string) int {
+	value, _ := m.Pop(ctx, key).(int)
+	return value
+}
+
+// PopBool is Pop for a bool value.
+func (m *Manager) PopBool(ctx context.Context, key string) bool {
+	value, _ := m.Pop(ctx, key).(bool)
+	return value
+}
+
+// RenewToken moves the session to a new token while keeping its data. Call
+// it whenever the privilege level changes, such as on login and logout, so a
+// token planted before then is of no use to an attacker.
+func (m *Manager) RenewToken(ctx context.Context) error {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.token != "" {
+		if err := m.Store.Delete(ctx, st.token); err != nil {
+			return err
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	st.token = token
+	st.data.Deadline = time.Now().Add(m.Lifetime)
+	st.modified = true
+
+	return nil
+}
+
+// Destroy deletes the session and its data, and expires the cookie.
+func (m *Manager) Destroy(ctx context.Context) error {
+	st := getState(ctx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.token != "" {
+		if err := m.Store.Delete(ctx, st.token); err != nil {
+			return err
+		}
+	}
+
+	st.token = ""
+	st.data = data{Values: map[string]any{}}
+	st.destroyed = true
+
+	return nil
+}
+
+func (m *Manager) load(r *http.Request) (*state, error) {
+	st := &state{data: data{Values: map[string]any{}}}
+
+	cookie, err := r.Cookie(m.Cookie.Name)
+	if err != nil {
+		return st, nil
+	}
+
+	b, found, err := m.Store.Find(r.Context(), cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return st, nil
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&st.data); err != nil {
+		return nil, err
+	}
+
+	// Deadline is in the past only if the store kept the session a little
+	// longer than asked.
+	if time.Now().After(st.data.Deadline) {
+		return &state{data: data{Values: map[string]any{}}}, nil
+	}
+
+	st.token = cookie.Value
+
+	return st, nil
+}
+
+func (m *Manager) save(w http.ResponseWriter, r *http.Request, st *state) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.destroyed {
+		http.SetCookie(w, m.cookie("", time.Unix(1, 0), -1))
+		return nil
+	}
+
+	// With an idle timeout every request pushes the expiry back, not only
+	// those that change something.
+	touched := m.IdleTimeout > 0 && st.token != ""
+	if !st.modified && !touched {
+		return nil
+	}
+
+	if st.token == "" {
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		st.token = token
+		st.data.Deadline = time.Now().Add(m.Lifetime)
+	}
+
+	expiry := st.data.Deadline
+	if m.IdleTimeout > 0 {
+		if idle := time.Now().Add(m.IdleTimeout); idle.Before(expiry) {
+			expiry = idle
+		}
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&st.data); err != nil {
+		return err
+	}
+
+	if err := m.Store.Commit(r.Context(), st.token, b.Bytes(), expiry); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.cookie(st.token, expiry, int(time.Until(expiry).Seconds())))
+
+	return nil
+}
+
+func (m *Manager) cookie(token string, expiry time.Time, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     m.Cookie.Name,
+		Value:    token,
+		Domain:   m.Cookie.Domain,
+		Path:     m.Cookie.Path,
+		HttpOnly: m.Cookie.HttpOnly,
+		SameSite: m.Cookie.SameSite,
+		Secure:   m.Cookie.Secure,
+	}
+
+	if m.Cookie.Persist || maxAge < 0 {
+		cookie.Expires = expiry
+		cookie.MaxAge = maxAge
+	}
+
+	return cookie
+}
+
+func getState(ctx context.Context) *state {
+	st, ok := ctx.Value(contextKey{}).(*state)
+	if !ok {
+		panic("session: no session in the request context, is LoadAndSave missing?")
+	}
+
+	return st
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionWriter saves the session just before the response headers go out,
+// the last moment a cookie can still be set.
+type sessionWriter struct {
+	http.ResponseWriter
+	save      func()
+	committed bool
+}
+
+func (sw *sessionWriter) commit() {
+	if !sw.committed {
+		sw.committed = true
+		sw.save()
+	}
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	sw.commit()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.commit()
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
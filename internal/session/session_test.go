@@ -0,0 +1,243 @@
+package session_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/migrations"
+	"github.com/andremfp/snippetbox/internal/session"
+)
+
+func TestManager(t *testing.T) {
+	stores := []struct {
+		name     string
+		newStore func(t testing.TB) session.Store
+	}{
+		{"memory", func(t testing.TB) session.Store { return session.NewMemoryStore(0) }},
+		{"sqlite", newSQLiteStore},
+	}
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			testManager(t, func() *session.Manager {
+				return session.New(store.newStore(t))
+			})
+		})
+	}
+}
+
+func testManager(t *testing.T, newManager func() *session.Manager) {
+	sessions := newManager()
+	handler := sessions.LoadAndSave(newMux(t, sessions))
+
+	t.Run("values persist between requests", func(t *testing.T) {
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+
+		if got := serve(handler, "/get", cookie).Body.String(); got != "alice" {
+			t.Errorf("got %q, want %q", got, "alice")
+		}
+
+		serve(handler, "/remove", cookie)
+
+		if got := serve(handler, "/get", cookie).Body.String(); got != "" {
+			t.Errorf("got %q after remove, want %q", got, "")
+		}
+	})
+
+	t.Run("typed values round trip", func(t *testing.T) {
+		cookie := sessionCookie(t, serve(handler, "/put-int?n=42", nil))
+
+		if got := serve(handler, "/get-int", cookie).Body.String(); got != "42" {
+			t.Errorf("got %q, want %q", got, "42")
+		}
+	})
+
+	t.Run("popped values are gone on the next request", func(t *testing.T) {
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+
+		if got := serve(handler, "/pop", cookie).Body.String(); got != "alice" {
+			t.Errorf("got %q from the first pop, want %q", got, "alice")
+		}
+
+		if got := serve(handler, "/pop", cookie).Body.String(); got != "" {
+			t.Errorf("got %q from the second pop, want %q", got, "")
+		}
+	})
+
+	t.Run("cookie is http only and same site", func(t *testing.T) {
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+
+		if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" || cookie.Secure {
+			t.Errorf("got cookie %+v, want HttpOnly, SameSite=Lax, Path=/ and not Secure", cookie)
+		}
+	})
+
+	t.Run("cookie can be made secure", func(t *testing.T) {
+		secure := newManager()
+		secure.Cookie.Secure = true
+		handler := secure.LoadAndSave(newMux(t, secure))
+
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+
+		if !cookie.Secure {
+			t.Errorf("got cookie %+v, want Secure", cookie)
+		}
+	})
+
+	t.Run("untouched sessions set no cookie", func(t *testing.T) {
+		response := serve(handler, "/get", nil)
+
+		if cookies := response.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("got cookies %v, want none", cookies)
+		}
+	})
+
+	t.Run("renewing the token keeps the data and retires the old token", func(t *testing.T) {
+		old := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+		renewed := sessionCookie(t, serve(handler, "/renew", old))
+
+		if renewed.Value == old.Value {
+			t.Fatal("got the same token after renewal")
+		}
+
+		if got := serve(handler, "/get", renewed).Body.String(); got != "alice" {
+			t.Errorf("got %q with the new token, want %q", got, "alice")
+		}
+
+		if got := serve(handler, "/get", old).Body.String(); got != "" {
+			t.Errorf("got %q with the old token, want %q", got, "")
+		}
+	})
+
+	t.Run("destroyed sessions are gone and their cookie expired", func(t *testing.T) {
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+		expired := sessionCookie(t, serve(handler, "/destroy", cookie))
+
+		if expired.MaxAge >= 0 {
+			t.Errorf("got cookie MaxAge %d, want it expired", expired.MaxAge)
+		}
+
+		if got := serve(handler, "/get", cookie).Body.String(); got != "" {
+			t.Errorf("got %q from a destroyed session, want %q", got, "")
+		}
+	})
+
+	t.Run("expired sessions are dropped", func(t *testing.T) {
+		short := newManager()
+		short.Lifetime = 50 * time.Millisecond
+		handler := short.LoadAndSave(newMux(t, short))
+
+		cookie := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+		time.Sleep(100 * time.Millisecond)
+
+		if got := serve(handler, "/get", cookie).Body.String(); got != "" {
+			t.Errorf("got %q from an expired session, want %q", got, "")
+		}
+	})
+
+	t.Run("idle sessions are dropped and active ones kept", func(t *testing.T) {
+		idle := newManager()
+		idle.IdleTimeout = 200 * time.Millisecond
+		handler := idle.LoadAndSave(newMux(t, idle))
+
+		active := sessionCookie(t, serve(handler, "/put?name=alice", nil))
+		unused := sessionCookie(t, serve(handler, "/put?name=bob", nil))
+
+		for range 3 {
+			time.Sleep(100 * time.Millisecond)
+			serve(handler, "/get", active)
+		}
+
+		if got := serve(handler, "/get", active).Body.String(); got != "alice" {
+			t.Errorf("got %q from an active session, want %q", got, "alice")
+		}
+
+		if got := serve(handler, "/get", unused).Body.String(); got != "" {
+			t.Errorf("got %q from an idle session, want %q", got, "")
+		}
+	})
+}
+
+func newMux(t testing.TB, sessions *session.Manager) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/put", func(w http.ResponseWriter, r *http.Request) {
+		sessions.Put(r.Context(), "name", r.URL.Query().Get("name"))
+	})
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sessions.GetString(r.Context(), "name"))
+	})
+	mux.HandleFunc("/pop", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sessions.PopString(r.Context(), "name"))
+	})
+	mux.HandleFunc("/put-int", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		sessions.Put(r.Context(), "n", n)
+	})
+	mux.HandleFunc("/get-int", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sessions.GetInt(r.Context(), "n"))
+	})
+	mux.HandleFunc("/renew", func(w http.ResponseWriter, r *http.Request) {
+		if err := sessions.RenewToken(r.Context()); err != nil {
+			t.Errorf("could not renew token, %v", err)
+		}
+	})
+	mux.HandleFunc("/destroy", func(w http.ResponseWriter, r *http.Request) {
+		if err := sessions.Destroy(r.Context()); err != nil {
+			t.Errorf("could not destroy session, %v", err)
+		}
+	})
+	mux.HandleFunc("/remove", func(w http.ResponseWriter, r *http.Request) {
+		sessions.Remove(r.Context(), "name")
+	})
+
+	return mux
+}
+
+func newSQLiteStore(t testing.TB) session.Store {
+	t.Helper()
+	db, err := database.OpenDB(database.DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("could not open sqlite db, %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("could not load migrations, %v", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("could not migrate sqlite db, %v", err)
+	}
+
+	return session.NewSQLStore(db, 0)
+}
+
+func serve(handler http.Handler, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func sessionCookie(t testing.TB, response *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+
+	t.Fatal("response set no session cookie")
+	return nil
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Store keeps encoded session data by token. Find must not return a session
+// whose expiry has passed.
+type Store interface {
+	Find(ctx context.Context, token string) ([]byte, bool, error)
+	Commit(ctx context.Context, token string, b []byte, expiry time.Time) error
+	Delete(ctx context.Context, token string) error
+}
+
+type memoryItem struct {
+	data   []byte
+	expiry time.Time
+}
+
+// MemoryStore keeps sessions in the process, so they are lost on restart and
+// not shared between instances.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]memoryItem
+
+	cleanup
+}
+
+// NewMemoryStore returns an empty MemoryStore that drops expired sessions
+// every cleanupInterval. Zero disables the cleanup, leaving expired sessions
+// in memory until their token is next used.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{items: map[string]memoryItem{}}
+	s.start(cleanupInterval, s.DeleteExpired)
+
+	return s
+}
+
+func (s *MemoryStore) Find(ctx context.Context, token string) ([]byte, bool, error) {
+	s.mu.RLock()
+	item, ok := s.items[token]
+	s.mu.RUnlock()
+
+	if !ok || !time.Now().Before(item.expiry) {
+		return nil, false, nil
+	}
+
+	return item.data, true, nil
+}
+
+func (s *MemoryStore) Commit(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[token] = memoryItem{data: b, expiry: expiry}
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, token)
+
+	return nil
+}
+
+// DeleteExpired drops every session whose expiry has passed.
+func (s *MemoryStore) DeleteExpired(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for token, item := range s.items {
+		if !now.Before(item.expiry) {
+			delete(s.items, token)
+		}
+	}
+
+	return nil
+}
+
+// SQLStore keeps sessions in the sessions table, so they survive restarts and
+// are shared by every instance using the database. Expiry is stored as Unix
+// nanoseconds and compared with the application's clock, which keeps the
+// queries the same on MySQL and SQLite.
+type SQLStore struct {
+	DB *sql.DB
+
+	cleanup
+}
+
+// NewSQLStore returns an SQLStore that deletes expired rows every
+// cleanupInterval. Zero disables the cleanup.
+func NewSQLStore(db *sql.DB, cleanupInterval time.Duration) *SQLStore {
+	s := &SQLStore{DB: db}
+	s.start(cleanupInterval, s.DeleteExpired)
+
+	return s
+}
+
+func (s *SQLStore) Find(ctx context.Context, token string) ([]byte, bool, error) {
+	stmt := `SELECT data FROM sessions WHERE token = ? AND expiry > ?`
+
+	var b []byte
+
+	err := s.DB.QueryRowContext(ctx, stmt, token, time.Now().UnixNano()).Scan(&b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+func (s *SQLStore) Commit(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	stmt := `REPLACE INTO sessions (token, data, expiry) VALUES(?, ?, ?)`
+
+	_, err := s.DB.ExecContext(ctx, stmt, token, b, expiry.UnixNano())
+
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, token string) error {
+	stmt := `DELETE FROM sessions WHERE token = ?`
+
+	_, err := s.DB.ExecContext(ctx, stmt, token)
+
+	return err
+}
+
+// DeleteExpired deletes every session whose expiry has passed.
+func (s *SQLStore) DeleteExpired(ctx context.Context) error {
+	stmt := `DELETE FROM sessions WHERE expiry <= ?`
+
+	_, err := s.DB.ExecContext(ctx, stmt, time.Now().UnixNano())
+
+	return err
+}
+
+// cleanup runs a store's DeleteExpired in the background.
+type cleanup struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func (c *cleanup) start(interval time.Duration, deleteExpired func(context.Context) error) {
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stop = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// A failed cleanup is retried on the next tick, and until
+				// then Find still ignores the expired rows.
+				_ = deleteExpired(ctx)
+			}
+		}
+	}()
+}
+
+// StopCleanup stops the background cleanup and waits for it to exit.
+func (c *cleanup) StopCleanup() {
+	if c.stop == nil {
+		return
+	}
+
+	c.stop()
+	<-c.done
+}
@@ -0,0 +1,103 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+)
+
+var ErrBatchSize = errors.New("sweeper: batch size must be at least 1")
+
+// Sweeper periodically deletes expired snippets in batches of BatchSize.
+type Sweeper struct {
+	Store     database.Store
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+	// Now returns the current time. It defaults to time.Now and is swapped
+	// out in tests.
+	Now func() time.Time
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// Sweep deletes every snippet that has expired by Now, one batch at a time,
+// and returns how many were deleted.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	if s.BatchSize < 1 {
+		return 0, ErrBatchSize
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	before := now()
+	total := 0
+
+	for {
+		deleted, err := s.Store.DeleteExpired(ctx, before, s.BatchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+
+		// A short batch means nothing expired is left.
+		if deleted < s.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+// Start sweeps once straight away and then every Interval in the background
+// until Stop is called.
+func (s *Sweeper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			s.sweep(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels any sweep in progress and waits for the worker to exit.
+func (s *Sweeper) Stop() {
+	if s.stop == nil {
+		return
+	}
+
+	s.stop()
+	<-s.done
+}
+
+func (s *Sweeper) sweep(ctx context.Context) {
+	start := time.Now()
+
+	deleted, err := s.Sweep(ctx)
+	if err != nil && ctx.Err() == nil {
+		s.Logger.Error("sweeping expired snippets", slog.Int("deleted", deleted), slog.Any("error", err))
+	}
+
+	if deleted > 0 {
+		s.Logger.Info("purged expired snippets", slog.Int("deleted", deleted), slog.Duration("duration", time.Since(start)))
+	}
+}
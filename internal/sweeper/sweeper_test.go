@@ -0,0 +1,135 @@
+package sweeper_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/sweeper"
+)
+
+func TestSweep(t *testing.T) {
+	t.Run("purges expired snippets in batches", func(t *testing.T) {
+		store := database.NewMemoryStore()
+
+		for i := 0; i < 5; i++ {
+			mustInsert(t, store, 1)
+		}
+		live := mustInsert(t, store, 7)
+
+		// Two days from now every one day snippet has expired.
+		s := &sweeper.Sweeper{
+			Store:     store,
+			BatchSize: 2,
+			Now:       func() time.Time { return time.Now().Add(48 * time.Hour) },
+		}
+
+		got, err := s.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("got error %v, want nil", err)
+		}
+
+		if got != 5 {
+			t.Errorf("got %d snippets purged, want 5", got)
+		}
+
+		if _, err := store.Get(context.Background(), live); err != nil {
+			t.Errorf("got error %v getting live snippet, want nil", err)
+		}
+	})
+
+	t.Run("leaves snippets that have not expired yet", func(t *testing.T) {
+		store := database.NewMemoryStore()
+		mustInsert(t, store, 1)
+
+		s := &sweeper.Sweeper{Store: store, BatchSize: 10, Now: time.Now}
+
+		got, _ := s.Sweep(context.Background())
+		if got != 0 {
+			t.Errorf("got %d snippets purged, want 0", got)
+		}
+	})
+
+	t.Run("rejects an empty batch size", func(t *testing.T) {
+		s := &sweeper.Sweeper{Store: database.NewMemoryStore()}
+
+		_, err := s.Sweep(context.Background())
+		if !errors.Is(err, sweeper.ErrBatchSize) {
+			t.Errorf("got error %v, want %v", err, sweeper.ErrBatchSize)
+		}
+	})
+}
+
+func TestStartStop(t *testing.T) {
+	store := database.NewMemoryStore()
+	mustInsert(t, store, -1)
+	mustInsert(t, store, -1)
+
+	logs := &syncBuffer{}
+
+	s := &sweeper.Sweeper{
+		Store:     store,
+		Interval:  time.Hour,
+		BatchSize: 10,
+		Logger:    slog.New(slog.NewTextHandler(logs, nil)),
+	}
+
+	s.Start()
+
+	// The first sweep runs straight away, so wait for it rather than the
+	// hour long interval.
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "purged") {
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not purge expired snippets in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Stop()
+
+	want := `level=INFO msg="purged expired snippets" deleted=2 duration=`
+	if got := logs.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, want) {
+		t.Errorf("got log %q, want one line with %q", got, want)
+	}
+
+	deleted, _ := store.DeleteExpired(context.Background(), time.Now(), 10)
+	if deleted != 0 {
+		t.Errorf("got %d expired snippets left, want 0", deleted)
+	}
+}
+
+func mustInsert(t testing.TB, store database.Store, expires int) int {
+	t.Helper()
+
+	id, err := store.Insert(context.Background(), "title", "content", "", expires, 0)
+	if err != nil {
+		t.Fatalf("could not insert snippet, %v", err)
+	}
+
+	return id
+}
+
+// syncBuffer lets the test read the log while the sweeper writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,122 @@
+package syntax
+
+import "strings"
+
+// Language describes enough of a language's lexical syntax to pick out its
+// keywords, builtins, strings, numbers and comments.
+type Language struct {
+	// Name is what a snippet saves, and Label what the form shows.
+	Name  string
+	Label string
+
+	keywords   map[string]bool
+	builtins   map[string]bool
+	ignoreCase bool
+
+	// delimited are the tokens that run to a closing delimiter, even across
+	// lines: block comments and raw or triple-quoted strings.
+	delimited    []delimited
+	lineComments []string
+	// quotes are the characters that open a string with backslash escapes,
+	// which ends at the end of the line if it is not closed.
+	quotes string
+}
+
+type delimited struct {
+	open, close string
+	class       Class
+}
+
+// Languages are the languages snippets can be highlighted as, by label.
+var Languages = []*Language{
+	{
+		Name:         "c",
+		Label:        "C",
+		keywords:     words("auto break case const continue default do else enum extern for goto if inline register restrict return sizeof static struct switch typedef union volatile while"),
+		builtins:     words("bool char double float int long short signed unsigned void size_t NULL true false"),
+		delimited:    []delimited{{"/*", "*/", Comment}},
+		lineComments: []string{"//"},
+		quotes:       `"'`,
+	},
+	{
+		Name:         "go",
+		Label:        "Go",
+		keywords:     words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var"),
+		builtins:     words("any bool byte comparable complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr true false iota nil append cap clear close complex copy delete imag len make max min new panic print println real recover"),
+		delimited:    []delimited{{"/*", "*/", Comment}, {"`", "`", String}},
+		lineComments: []string{"//"},
+		quotes:       `"'`,
+	},
+	{
+		Name:         "javascript",
+		Label:        "JavaScript",
+		keywords:     words("async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return static super switch this throw try typeof var void while with yield"),
+		builtins:     words("true false null undefined NaN Infinity Array Boolean Date Error JSON Map Math Number Object Promise RegExp Set String Symbol console document window"),
+		delimited:    []delimited{{"/*", "*/", Comment}, {"`", "`", String}},
+		lineComments: []string{"//"},
+		quotes:       `"'`,
+	},
+	{
+		Name:     "json",
+		Label:    "JSON",
+		builtins: words("true false null"),
+		quotes:   `"`,
+	},
+	{
+		Name:         "python",
+		Label:        "Python",
+		keywords:     words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield"),
+		builtins:     words("True False None self abs all any bool bytes dict enumerate float int isinstance len list map max min object open print range repr set sorted str sum super tuple type zip"),
+		delimited:    []delimited{{`"""`, `"""`, String}, {`'''`, `'''`, String}},
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	},
+	{
+		Name:         "rust",
+		Label:        "Rust",
+		keywords:     words("as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod move mut pub ref return static struct super trait type unsafe use where while"),
+		builtins:     words("bool char f32 f64 i8 i16 i32 i64 i128 isize str u8 u16 u32 u64 u128 usize true false self Self Box Option Result Some None Ok Err String Vec"),
+		delimited:    []delimited{{"/*", "*/", Comment}},
+		lineComments: []string{"//"},
+		// Not ', which also starts lifetimes.
+		quotes: `"`,
+	},
+	{
+		Name:         "shell",
+		Label:        "Shell",
+		keywords:     words("case do done elif else esac fi for function if in local return select then until while"),
+		builtins:     words("alias cd echo eval exec exit export printf read set shift source test trap unset"),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	},
+	{
+		Name:         "sql",
+		Label:        "SQL",
+		keywords:     words("add all alter and as asc begin between by case check commit constraint create default delete desc distinct drop else end exists foreign from group having if in index inner insert into is join key left like limit not null offset on or order outer primary references right rollback select set table then union unique update values when where"),
+		builtins:     words("bigint blob boolean char date datetime decimal int integer text timestamp varchar avg coalesce count max min now sum true false"),
+		ignoreCase:   true,
+		delimited:    []delimited{{"/*", "*/", Comment}},
+		lineComments: []string{"--"},
+		quotes:       `'"`,
+	},
+}
+
+// Lookup returns the language called name, or nil if there is none.
+func Lookup(name string) *Language {
+	for _, lang := range Languages {
+		if lang.Name == name {
+			return lang
+		}
+	}
+
+	return nil
+}
+
+func words(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+
+	return set
+}
@@ -0,0 +1,198 @@
+// Package syntax splits source code into numbered lines of classified
+// tokens, so snippets can be highlighted on the server instead of by a
+// script in the browser.
+package syntax
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class is what a token is. Its String is the CSS class view.html gives the
+// token, so only these few names ever reach a page.
+type Class int
+
+const (
+	Plain Class = iota
+	Keyword
+	Builtin
+	String
+	Number
+	Comment
+)
+
+func (c Class) String() string {
+	switch c {
+	case Keyword:
+		return "keyword"
+	case Builtin:
+		return "builtin"
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Comment:
+		return "comment"
+	}
+
+	return ""
+}
+
+type Token struct {
+	Class Class
+	Text  string
+}
+
+// Line is one line of highlighted code. Number is 1-based.
+type Line struct {
+	Number int
+	Tokens []Token
+}
+
+// Highlight splits content into lines of tokens as the named language
+// would read it. An unknown or empty language gives plain text.
+func Highlight(content string, language string) []Line {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+
+	var tokens []Token
+	if lang := Lookup(language); lang != nil {
+		tokens = lang.tokenize(content)
+	} else {
+		tokens = []Token{{Plain, content}}
+	}
+
+	lines := []Line{{Number: 1}}
+	for _, token := range tokens {
+		// Block comments and raw strings can span lines, so a token is cut
+		// wherever it crosses one.
+		for i, text := range strings.Split(token.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, Line{Number: len(lines) + 1})
+			}
+			if text != "" {
+				line := &lines[len(lines)-1]
+				line.Tokens = append(line.Tokens, Token{token.Class, text})
+			}
+		}
+	}
+
+	return lines
+}
+
+func (lang *Language) tokenize(s string) []Token {
+	var tokens []Token
+
+	// Runs of plain text are kept together to keep the markup small. They
+	// are sliced out of s once they end rather than grown token by token,
+	// which would copy the run again for every token in it.
+	plain := -1
+	flush := func(end int) {
+		if plain >= 0 {
+			tokens = append(tokens, Token{Plain, s[plain:end]})
+			plain = -1
+		}
+	}
+
+	for i := 0; i < len(s); {
+		class, n := lang.next(s[i:])
+		if class == Plain {
+			if plain < 0 {
+				plain = i
+			}
+		} else {
+			flush(i)
+			tokens = append(tokens, Token{class, s[i : i+n]})
+		}
+		i += n
+	}
+	flush(len(s))
+
+	return tokens
+}
+
+// next returns the class and length in bytes of the token s starts with.
+func (lang *Language) next(s string) (Class, int) {
+	for _, d := range lang.delimited {
+		if strings.HasPrefix(s, d.open) {
+			end := strings.Index(s[len(d.open):], d.close)
+			if end < 0 {
+				return d.class, len(s)
+			}
+			return d.class, len(d.open) + end + len(d.close)
+		}
+	}
+
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			end := strings.IndexByte(s, '\n')
+			if end < 0 {
+				end = len(s)
+			}
+			return Comment, end
+		}
+	}
+
+	if strings.IndexByte(lang.quotes, s[0]) >= 0 {
+		return String, quoted(s)
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+
+	switch {
+	case '0' <= r && r <= '9':
+		// Good enough for 42, 0x2A, 1_000 and 4.2e1 alike.
+		return Number, span(s, func(r rune) bool { return isWordRune(r) || r == '.' })
+	case isWordRune(r):
+		n := span(s, isWordRune)
+		word := s[:n]
+		if lang.ignoreCase {
+			word = strings.ToLower(word)
+		}
+		switch {
+		case lang.keywords[word]:
+			return Keyword, n
+		case lang.builtins[word]:
+			return Builtin, n
+		}
+		return Plain, n
+	}
+
+	return Plain, size
+}
+
+// span returns the length in bytes of the run of runes at the start of s
+// that f accepts.
+func span(s string, f func(rune) bool) int {
+	if end := strings.IndexFunc(s, func(r rune) bool { return !f(r) }); end >= 0 {
+		return end
+	}
+
+	return len(s)
+}
+
+// quoted returns the length of the string literal s starts with, which ends
+// at the matching quote or, if there is none, at the end of the line.
+func quoted(s string) int {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return i
+		case quote:
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
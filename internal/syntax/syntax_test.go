@@ -0,0 +1,175 @@
+package syntax_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andremfp/snippetbox/internal/syntax"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		language string
+		want     []string
+	}{
+		{
+			name:     "go",
+			content:  "func main() {\n\tfmt.Println(\"hi\", 42) // greet\n}\n",
+			language: "go",
+			want: []string{
+				"1: keyword(func) main() {",
+				"2: \tfmt.Println(string(\"hi\"), number(42)) comment(// greet)",
+				"3: }",
+			},
+		},
+		{
+			name:     "block comments and raw strings span lines",
+			content:  "/* one\ntwo */ x := `a\n\nb`",
+			language: "go",
+			want: []string{
+				"1: comment(/* one)",
+				"2: comment(two */) x := string(`a)",
+				"3: ",
+				"4: string(b`)",
+			},
+		},
+		{
+			name:     "unterminated string stops at the end of the line",
+			content:  "s = 'open\nx = None",
+			language: "python",
+			want: []string{
+				"1: s = string('open)",
+				"2: x = builtin(None)",
+			},
+		},
+		{
+			name:     "escaped quotes do not end a string",
+			content:  `"a\"b" + c`,
+			language: "javascript",
+			want:     []string{`1: string("a\"b") + c`},
+		},
+		{
+			name:     "sql keywords ignore case",
+			content:  "SELECT COUNT(*) FROM t -- all\nwhere id = 1",
+			language: "sql",
+			want: []string{
+				"1: keyword(SELECT) builtin(COUNT)(*) keyword(FROM) t comment(-- all)",
+				"2: keyword(where) id = number(1)",
+			},
+		},
+		{
+			name:     "words containing keywords or digits are plain",
+			content:  "format x1 iffy",
+			language: "go",
+			want:     []string{"1: format x1 iffy"},
+		},
+		{
+			name:     "plain text is one token per line",
+			content:  "func <b>\r\n\"x\"",
+			language: "",
+			want:     []string{"1: func <b>", "2: \"x\""},
+		},
+		{
+			name:     "unknown language is plain text",
+			content:  "func",
+			language: "cobol",
+			want:     []string{"1: func"},
+		},
+		{
+			name:     "empty content has no lines",
+			content:  "",
+			language: "go",
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range syntax.Highlight(tt.content, tt.language) {
+				got = append(got, format(line))
+			}
+
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestHighlightLargePlainText(t *testing.T) {
+	// A megabyte of punctuation is a million plain tokens in one run.
+	content := strings.Repeat("+-*/(){}[];,.", 1<<20/13)
+
+	allocs := testing.AllocsPerRun(1, func() {
+		syntax.Highlight(content, "go")
+	})
+
+	if allocs > 1000 {
+		t.Errorf("got %.0f allocations, want the plain run built without copying it per token", allocs)
+	}
+
+	lines := syntax.Highlight(content, "go")
+	if len(lines) != 1 || len(lines[0].Tokens) != 1 || lines[0].Tokens[0].Text != content {
+		t.Errorf("got %d lines, want the content as one plain token", len(lines))
+	}
+}
+
+func BenchmarkHighlight(b *testing.B) {
+	content := strings.Repeat("func main() {\n\tfmt.Println(\"hi\", 42) // greet\n}\n", 1000)
+
+	for range b.N {
+		syntax.Highlight(content, "go")
+	}
+}
+
+func TestClassString(t *testing.T) {
+	classes := []syntax.Class{syntax.Keyword, syntax.Builtin, syntax.String, syntax.Number, syntax.Comment}
+
+	for _, class := range classes {
+		name := class.String()
+		if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz") != "" {
+			t.Errorf("got class name %q for %d, want a lower-case word", name, class)
+		}
+	}
+
+	if got := syntax.Plain.String(); got != "" {
+		t.Errorf("got class name %q for plain text, want none", got)
+	}
+
+	if got := syntax.Class(99).String(); got != "" {
+		t.Errorf("got class name %q for an unknown class, want none", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, lang := range syntax.Languages {
+		if got := syntax.Lookup(lang.Name); got != lang {
+			t.Errorf("got %v looking up %q, want %v", got, lang.Name, lang)
+		}
+	}
+
+	if got := syntax.Lookup(""); got != nil {
+		t.Errorf("got %v for plain text, want nil", got)
+	}
+}
+
+// format writes a line as "n: text", wrapping each highlighted token in its
+// class name.
+func format(line syntax.Line) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d: ", line.Number)
+
+	for _, token := range line.Tokens {
+		if token.Class == syntax.Plain {
+			b.WriteString(token.Text)
+			continue
+		}
+		fmt.Fprintf(&b, "%s(%s)", token.Class, token.Text)
+	}
+
+	return b.String()
+}
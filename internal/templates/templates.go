@@ -4,27 +4,159 @@ import (
 	"embed"
 	"html/template"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/andremfp/snippetbox/internal/database"
+	"github.com/andremfp/snippetbox/internal/diff"
+	"github.com/andremfp/snippetbox/internal/syntax"
 )
 
 //go:embed ui
 var Content embed.FS
 
 type TemplateData struct {
-	CurrentYear int
-	Snippet     *database.Snippet
-	Snippets    []*database.Snippet
-	Form        any
+	CurrentYear     int
+	Snippet         *database.Snippet
+	Snippets        []*database.Snippet
+	Revisions       []*database.Revision
+	Diff            *Diff
+	Pagination      *Pagination
+	Query           string
+	Form            any
+	IsAuthenticated bool
+	IsOwner         bool
+	Flash           []string
+	CSRFToken       string
+	Tokens          []*database.Token
+	NewToken        string
+}
+
+// Pagination links the home page to its neighbouring pages. An empty link
+// means there is no page that way.
+type Pagination struct {
+	Newer string
+	Older string
+}
+
+// Diff holds two revisions of a snippet and the changes between them.
+// TooLarge means they differ too much to work the changes out.
+type Diff struct {
+	From     *database.Snippet
+	To       *database.Snippet
+	Hunks    []diff.Hunk
+	TooLarge bool
 }
 
 func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// highlight escapes text and marks the start of every word that a term of
+// the search query matches, the way database.SearchTerms splits them.
+func highlight(text string, query string) template.HTML {
+	terms := database.SearchTerms(query)
+
+	var b strings.Builder
+
+	for text != "" {
+		start := strings.IndexFunc(text, isWordRune)
+		if start < 0 {
+			start = len(text)
+		}
+		b.WriteString(template.HTMLEscapeString(text[:start]))
+		text = text[start:]
+
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		text = text[end:]
+
+		if n := matchLength(word, terms); n > 0 {
+			b.WriteString("<mark>" + template.HTMLEscapeString(word[:n]) + "</mark>")
+			word = word[n:]
+		}
+		b.WriteString(template.HTMLEscapeString(word))
+	}
+
+	return template.HTML(b.String())
+}
+
+// excerpt returns the first line of content with a match for the search
+// query, or else its first line, shortened to a readable length.
+func excerpt(content string, query string) string {
+	terms := database.SearchTerms(query)
+	lines := strings.Split(content, "\n")
+	line := lines[0]
+
+	for _, candidate := range lines {
+		if slices.ContainsFunc(database.SearchTerms(candidate), func(word string) bool {
+			return matchLength(word, terms) > 0
+		}) {
+			line = candidate
+			break
+		}
+	}
+
+	line = strings.TrimSpace(line)
+	if runes := []rune(line); len(runes) > 120 {
+		line = string(runes[:120]) + "…"
+	}
+
+	return line
+}
+
+// matchLength returns how many bytes at the start of word the longest
+// matching term covers, or 0 when none match.
+func matchLength(word string, terms []string) int {
+	lower := strings.ToLower(word)
+	longest := 0
+
+	for _, term := range terms {
+		if !strings.HasPrefix(lower, term) {
+			continue
+		}
+
+		// Lower-casing keeps the number of runes but not always the number
+		// of bytes, so count the prefix in runes of the original word.
+		n := 0
+		for range utf8.RuneCountInString(term) {
+			_, size := utf8.DecodeRuneInString(word[n:])
+			n += size
+		}
+
+		longest = max(longest, n)
+	}
+
+	return longest
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// languageLabel names a snippet's language for display, falling back to
+// the saved name for a language no longer supported.
+func languageLabel(name string) string {
+	if lang := syntax.Lookup(name); lang != nil {
+		return lang.Label
+	}
+
+	return name
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"highlight":     highlight,
+	"excerpt":       excerpt,
+	"sourceLines":   syntax.Highlight,
+	"languages":     func() []*syntax.Language { return syntax.Languages },
+	"languageLabel": languageLabel,
 }
 
 func NewTemplateCache() (map[string]*template.Template, error) {
@@ -34,6 +166,12 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 		"ui/html/pages/home.html",
 		"ui/html/pages/view.html",
 		"ui/html/pages/create.html",
+		"ui/html/pages/history.html",
+		"ui/html/pages/diff.html",
+		"ui/html/pages/search.html",
+		"ui/html/pages/signup.html",
+		"ui/html/pages/login.html",
+		"ui/html/pages/tokens.html",
 	}
 
 	for _, page := range pages {
@@ -8,12 +8,18 @@ import (
 
 func TestNewTemplateCache(t *testing.T) {
 
-	numPages := 3
+	numPages := 9
 
 	want := []string{
 		"home.html",
 		"view.html",
 		"create.html",
+		"history.html",
+		"diff.html",
+		"search.html",
+		"signup.html",
+		"login.html",
+		"tokens.html",
 	}
 
 	cache, err := templates.NewTemplateCache()
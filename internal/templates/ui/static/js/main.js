@@ -5,4 +5,46 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Highlight the lines a #L10 or #L10-L20 fragment points at. A single line
+// is also styled by :target, but a range has no element of its own.
+var lines = document.querySelectorAll(".source .line");
+var selectedFrom = 0;
+
+function selectLines() {
+	var match = window.location.hash.match(/^#L(\d+)(?:-L(\d+))?$/);
+	var from = match ? parseInt(match[1], 10) : 0;
+	var to = match && match[2] ? parseInt(match[2], 10) : from;
+	if (from > to) {
+		var swap = from;
+		from = to;
+		to = swap;
+	}
+
+	for (var i = 0; i < lines.length; i++) {
+		lines[i].classList.toggle("selected", i + 1 >= from && i + 1 <= to);
+	}
+
+	selectedFrom = from;
+	if (from > 0 && from <= lines.length) {
+		lines[from - 1].scrollIntoView();
+	}
+}
+
+// Shift-clicking a line number extends the selection to it.
+for (var i = 0; i < lines.length; i++) {
+	lines[i].querySelector(".lineno").addEventListener("click", function (event) {
+		if (!event.shiftKey || selectedFrom == 0) {
+			return;
+		}
+		event.preventDefault();
+		var line = this.getAttribute("href").slice(2);
+		window.location.hash = "L" + Math.min(selectedFrom, line) + "-L" + Math.max(selectedFrom, line);
+	});
+}
+
+if (lines.length > 0) {
+	window.addEventListener("hashchange", selectLines);
+	selectLines();
+}
@@ -108,3 +108,55 @@ func TestPermittedValue(t *testing.T) {
 		})
 	}
 }
+
+func TestMatches(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{
+			name:     "Valid email",
+			value:    "alice@example.com",
+			expected: true,
+		},
+		{
+			name:     "Email without a domain",
+			value:    "alice@",
+			expected: false,
+		},
+		{
+			name:     "Email without an at sign",
+			value:    "alice.example.com",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validator.Matches(tt.value, validator.EmailRX); got != tt.expected {
+				t.Errorf("Matches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNonFieldErrors(t *testing.T) {
+	v := &validator.Validator{}
+
+	if !v.Valid() {
+		t.Fatal("Expected an empty validator to be valid")
+	}
+
+	v.AddNonFieldError("Email or password is incorrect")
+
+	if v.Valid() {
+		t.Error("Expected a validator with a non-field error to be invalid")
+	}
+
+	if len(v.NonFieldErrors) != 1 {
+		t.Errorf("Expected 1 non-field error, got %d", len(v.NonFieldErrors))
+	}
+}